@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+)
+
+// envFlag collects repeated --env KEY=VALUE flags.
+type envFlag map[string]string
+
+func (e envFlag) String() string {
+	pairs := make([]string, 0, len(e))
+	for key, value := range e {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (e envFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid environment variable %q, must be KEY=VALUE", value)
+	}
+	e[key] = val
+	return nil
+}
+
+type actionFlags struct {
+	action *string
+	exec   *bool
+	cwd    *string
+	env    envFlag
+}
+
+func addActionFlags(flags *flag.FlagSet) *actionFlags {
+	f := &actionFlags{env: envFlag{}}
+	f.action = flags.String(
+		"action",
+		"",
+		`With --learn, run this JSON action instead of the command, e.g. {"exec": ["notify-send", "hi"]}`,
+	)
+	f.exec = flags.Bool(
+		"exec",
+		false,
+		"With --learn, run the arguments after -- directly instead of running the command with sh",
+	)
+	f.cwd = flags.String("cwd", "", "With --learn, run the gesture's action in this directory")
+	flags.Var(f.env, "env", "With --learn, set KEY=VALUE in the gesture's environment (repeatable)")
+	return f
+}
+
+// isSet reports whether any action flag was given.
+func (f *actionFlags) isSet() bool {
+	return *f.action != "" || *f.exec || *f.cwd != "" || len(f.env) > 0
+}
+
+// build returns the action described by the flags for a new gesture, with
+// args as the argv for --exec, or nil when no action flag was given. Actions
+// that set neither shell nor exec run command with sh.
+func (f *actionFlags) build(command string, args []string) (*models.Action, error) {
+	return f.apply(models.Action{Shell: command}, args)
+}
+
+// apply returns base changed by the flags, or nil when no action flag was
+// given. What is run is only replaced by --exec, or by an --action that sets
+// shell or exec; its other fields are merged into base.
+func (f *actionFlags) apply(base models.Action, args []string) (*models.Action, error) {
+	if !f.isSet() {
+		return nil, nil
+	}
+
+	action := &models.Action{
+		Shell: base.Shell,
+		Exec:  slices.Clone(base.Exec),
+		Env:   maps.Clone(base.Env),
+		Cwd:   base.Cwd,
+	}
+
+	if *f.action != "" {
+		var given models.Action
+		if err := json.Unmarshal([]byte(*f.action), &given); err != nil {
+			return nil, fmt.Errorf("invalid --action: %w", err)
+		}
+		if *f.exec && (given.Shell != "" || len(given.Exec) > 0) {
+			return nil, errors.New("--exec cannot be used with an --action that sets shell or exec")
+		}
+		if given.Shell != "" || len(given.Exec) > 0 {
+			action.Shell, action.Exec = given.Shell, given.Exec
+		}
+		if given.Cwd != "" {
+			action.Cwd = given.Cwd
+		}
+		if len(given.Env) > 0 && action.Env == nil {
+			action.Env = map[string]string{}
+		}
+		maps.Copy(action.Env, given.Env)
+	}
+	if *f.exec {
+		if len(args) == 0 {
+			return nil, errors.New("--exec needs a program to run after --")
+		}
+		action.Shell, action.Exec = "", args
+	}
+	if *f.cwd != "" {
+		action.Cwd = *f.cwd
+	}
+	for key, value := range f.env {
+		if action.Env == nil {
+			action.Env = map[string]string{}
+		}
+		action.Env[key] = value
+	}
+	return action, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/analyze"
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
+)
+
+func runAnalyze(args []string) {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	gesturesFile := flags.String("gestures", "", "Read gestures from this file instead of gestures.json")
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		log.Fatalf("Unknown arguments: %v", flags.Args())
+	}
+
+	if *gesturesFile != "" {
+		config.SetPath(*gesturesFile)
+	}
+
+	savedGestures, err := gestures.LoadGestures()
+	if err != nil {
+		log.Fatal("Failed to load gestures:", err)
+	}
+	for i := range savedGestures {
+		stroke.ForGesture(&savedGestures[i]).Prepare(&savedGestures[i])
+	}
+
+	report := analyze.Analyze(savedGestures)
+	if *asJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal("Failed to write report:", err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	"github.com/ThatOtherAndrew/Hexecute/internal/daemon"
+	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/learn"
+	"github.com/ThatOtherAndrew/Hexecute/internal/loop"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/opengl"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
+	"github.com/ThatOtherAndrew/Hexecute/pkg/wayland"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// idlePollInterval is how often the daemon reads and handles Wayland events
+// while the overlay is hidden.
+const idlePollInterval = 100 * time.Millisecond
+
+func runDaemon(args []string) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		log.Fatalf("Unknown arguments: %v", flags.Args())
+	}
+
+	server, err := daemon.Listen()
+	if err != nil {
+		log.Fatal("Failed to start daemon:", err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	window, err := wayland.NewWaylandWindow()
+	if err != nil {
+		log.Fatal("Failed to create Wayland window:", err)
+	}
+	defer window.Destroy()
+
+	base := &models.App{}
+	if err := reload(base); err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+
+	opengl := opengl.New(base)
+	if err := opengl.InitGL(); err != nil {
+		log.Fatal("Failed to initialize OpenGL:", err)
+	}
+	gl.ClearColor(0, 0, 0, 0)
+
+	window.Hide()
+	log.Println("Daemon ready")
+
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := window.Dispatch(); err != nil {
+				log.Fatal("Lost connection to the compositor:", err)
+			}
+		case <-signals:
+			log.Println("Daemon stopping")
+			return
+		case call := <-server.Calls:
+			switch call.Request.Type {
+			case daemon.RequestShow, daemon.RequestLearn:
+				session := *base
+				session.State = models.StateIdle
+				session.StartTime = time.Now()
+				if call.Request.Type == daemon.RequestLearn {
+					if call.Request.Learn == nil {
+						call.Reply(errors.New("learn request has no options"))
+						continue
+					}
+					if err := learn.New(&session).Start(*call.Request.Learn); err != nil {
+						call.Reply(err)
+						continue
+					}
+				}
+
+				if err := window.Show(); err != nil {
+					call.Reply(err)
+					continue
+				}
+				call.Reply(nil)
+
+				for range 5 {
+					window.PollEvents()
+					gl.Clear(gl.COLOR_BUFFER_BIT)
+					window.SwapBuffers()
+				}
+				overlay := &sessionWindow{
+					WaylandWindow: window,
+					signals:       signals,
+					calls:         server.Calls,
+					base:          base,
+				}
+				loop.New(&session).Run(overlay)
+				window.Hide()
+				if overlay.stop {
+					return
+				}
+
+				// Learning and adaptation may have changed the saved gestures.
+				if err := reloadGestures(base); err != nil {
+					log.Printf("Failed to reload gestures: %v", err)
+				}
+			case daemon.RequestReload:
+				call.Reply(reloadLogged(base))
+			case daemon.RequestQuit:
+				log.Println("Daemon stopping")
+				call.Reply(nil)
+				return
+			default:
+				call.Reply(fmt.Errorf("unknown request %q", call.Request.Type))
+			}
+		}
+	}
+}
+
+// sessionWindow is the overlay while a session is shown. Between frames, it
+// handles what would otherwise wait until the overlay closes: signals and quit
+// requests close the overlay and stop the daemon, reloads are applied to the
+// next session, and other requests are refused.
+type sessionWindow struct {
+	*wayland.WaylandWindow
+	signals <-chan os.Signal
+	calls   <-chan *daemon.Call
+	base    *models.App
+	stop    bool
+}
+
+func (w *sessionWindow) ShouldClose() bool {
+	select {
+	case <-w.signals:
+		log.Println("Daemon stopping")
+		w.stop = true
+	case call := <-w.calls:
+		switch call.Request.Type {
+		case daemon.RequestShow, daemon.RequestLearn:
+			call.Reply(errors.New("the overlay is already shown"))
+		case daemon.RequestReload:
+			call.Reply(reloadLogged(w.base))
+		case daemon.RequestQuit:
+			log.Println("Daemon stopping")
+			call.Reply(nil)
+			w.stop = true
+		default:
+			call.Reply(fmt.Errorf("unknown request %q", call.Request.Type))
+		}
+	default:
+	}
+	return w.stop || w.WaylandWindow.ShouldClose()
+}
+
+// reloadLogged reloads settings and gestures for a reload request, logging
+// the outcome.
+func reloadLogged(app *models.App) error {
+	err := reload(app)
+	if err != nil {
+		log.Printf("Failed to reload config: %v", err)
+	} else {
+		log.Println("Reloaded config")
+	}
+	return err
+}
+
+func reload(app *models.App) error {
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return err
+	}
+	if err := reloadGestures(app); err != nil {
+		return err
+	}
+	app.Settings = settings
+	return nil
+}
+
+func reloadGestures(app *models.App) error {
+	savedGestures, err := gestures.LoadGestures()
+	if err != nil {
+		return err
+	}
+	for i := range savedGestures {
+		stroke.ForGesture(&savedGestures[i]).Prepare(&savedGestures[i])
+	}
+	app.SavedGestures = savedGestures
+	log.Printf("Loaded %d gesture(s)", len(savedGestures))
+	return nil
+}
+
+func runShow(args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	learnCommand := flags.String("learn", "", "Learn a new gesture for the specified command")
+	learnName := flags.String("name", "", "With --learn, show the gesture under this name instead of its command")
+	learnReject := flags.Bool("learn-reject", false, "Learn rejection samples that should never run a command")
+	learnSamples := flags.Int("samples", 3, "Number of times to draw a gesture when learning it")
+	appendSamples := flags.Bool("append", false, "With --learn, add to an existing gesture instead of replacing it")
+	rotation := flags.String(
+		"rotation",
+		models.RotationBounded,
+		"Rotation invariance of a learned gesture: none, bounded or full",
+	)
+	startDirection := flags.Bool(
+		"start-direction",
+		false,
+		"Only match a learned gesture when it is started in the same direction",
+	)
+	enforceDirection := flags.Bool(
+		"enforce-direction",
+		false,
+		"Only match a learned gesture when it is drawn with the same winding and start-to-end direction",
+	)
+	reloadConfig := flags.Bool("reload", false, "Reload settings and gestures instead of showing the overlay")
+	quit := flags.Bool("quit", false, "Stop the daemon instead of showing the overlay")
+	actionFlags := addActionFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() > 0 && !*actionFlags.exec {
+		log.Fatalf("Unknown arguments: %v", flags.Args())
+	}
+
+	if actionFlags.isSet() && *learnCommand == "" {
+		log.Fatal("--action, --exec, --cwd and --env can only be used with --learn")
+	}
+	action, err := actionFlags.build(*learnCommand, flags.Args())
+	if err != nil {
+		log.Fatal("Failed to parse action:", err)
+	}
+
+	if *learnSamples < 1 {
+		log.Fatalf("Invalid number of samples %d, must be at least 1", *learnSamples)
+	}
+
+	switch *rotation {
+	case models.RotationNone, models.RotationBounded, models.RotationFull:
+	default:
+		log.Fatalf("Invalid rotation %q, must be none, bounded or full", *rotation)
+	}
+
+	request := daemon.Request{Type: daemon.RequestShow}
+	switch {
+	case *quit:
+		request.Type = daemon.RequestQuit
+	case *reloadConfig:
+		request.Type = daemon.RequestReload
+	case *learnCommand != "" || *learnReject:
+		request.Type = daemon.RequestLearn
+		request.Learn = &learn.Options{
+			Command:          *learnCommand,
+			Name:             *learnName,
+			Action:           action,
+			Reject:           *learnReject,
+			Samples:          *learnSamples,
+			Append:           *appendSamples,
+			Rotation:         *rotation,
+			StartDirection:   *startDirection,
+			EnforceDirection: *enforceDirection,
+		}
+	}
+
+	if err := daemon.Send(request); err != nil {
+		log.Fatal("Daemon request failed:", err)
+	}
+}
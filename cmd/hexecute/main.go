@@ -1,22 +1,24 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/ThatOtherAndrew/Hexecute/internal/adapt"
 	"github.com/ThatOtherAndrew/Hexecute/internal/config"
-	"github.com/ThatOtherAndrew/Hexecute/internal/draw"
-	"github.com/ThatOtherAndrew/Hexecute/internal/execute"
 	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/learn"
+	"github.com/ThatOtherAndrew/Hexecute/internal/loop"
 	"github.com/ThatOtherAndrew/Hexecute/internal/models"
 	"github.com/ThatOtherAndrew/Hexecute/internal/opengl"
-	"github.com/ThatOtherAndrew/Hexecute/internal/spawn"
+	"github.com/ThatOtherAndrew/Hexecute/internal/record"
 	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
-	"github.com/ThatOtherAndrew/Hexecute/internal/update"
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
 	"github.com/ThatOtherAndrew/Hexecute/pkg/wayland"
 	"github.com/go-gl/gl/v4.1-core/gl"
 )
@@ -30,71 +32,213 @@ type App struct {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "analyze":
+			runAnalyze(os.Args[2:])
+			return
+		case "recognize":
+			runRecognize(os.Args[2:])
+			return
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "show":
+			runShow(os.Args[2:])
+			return
+		case "edit":
+			runEdit(os.Args[2:])
+			return
+		case "duplicate":
+			runDuplicate(os.Args[2:])
+			return
+		case "enable":
+			runToggle(os.Args[2:], true)
+			return
+		case "disable":
+			runToggle(os.Args[2:], false)
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		}
+	}
+
 	learnCommand := flag.String("learn", "", "Learn a new gesture for the specified command")
+	learnName := flag.String("name", "", "With --learn, show the gesture under this name instead of its command")
+	appendSamples := flag.Bool(
+		"append",
+		false,
+		"With --learn, add the new samples to an existing gesture instead of replacing it",
+	)
+	learnReject := flag.Bool(
+		"learn-reject",
+		false,
+		"Learn rejection samples, such as scribbles, that should never run a command",
+	)
+	learnSamples := flag.Int("samples", 3, "Number of times to draw a gesture when learning it")
 	listGestures := flag.Bool("list", false, "List all registered gestures")
-	removeGesture := flag.String("remove", "", "Remove a gesture by command name")
+	removeGesture := flag.String("remove", "", "Remove a gesture by name or command")
+	rollbackGesture := flag.String(
+		"rollback",
+		"",
+		"Undo the last adaptive update to a gesture by name or command",
+	)
+	rotation := flag.String(
+		"rotation",
+		models.RotationBounded,
+		"Rotation invariance of a learned gesture: none, bounded or full",
+	)
+	startDirection := flag.Bool(
+		"start-direction",
+		false,
+		"Only match a learned gesture when it is started in the same direction",
+	)
+	enforceDirection := flag.Bool(
+		"enforce-direction",
+		false,
+		"Only match a learned gesture when it is drawn with the same winding and start-to-end direction",
+	)
+	printMatch := flag.Bool(
+		"print",
+		false,
+		"Print the command of the matched gesture instead of running it, exiting with status 1 if nothing matched",
+	)
+	gesturesFile := flag.String("gestures", "", "Read and write gestures from this file instead of gestures.json")
+	recordFile := flag.String("record", "", "Record the input of this session to a file")
+	replayFile := flag.String("replay", "", "Replay the input recorded in a file instead of reading it live")
+	headless := flag.Bool("headless", false, "With --replay, replay without opening a window or rendering")
+	actionFlags := addActionFlags(flag.CommandLine)
 	flag.Parse()
 
-	if flag.NArg() > 0 {
+	if flag.NArg() > 0 && !*actionFlags.exec {
 		log.Fatalf("Unknown arguments: %v", flag.Args())
 	}
 
+	if *learnName != "" && *learnCommand == "" {
+		log.Fatal("--name can only be used with --learn")
+	}
+
+	if actionFlags.isSet() && *learnCommand == "" {
+		log.Fatal("--action, --exec, --cwd and --env can only be used with --learn")
+	}
+	action, err := actionFlags.build(*learnCommand, flag.Args())
+	if err != nil {
+		log.Fatal("Failed to parse action:", err)
+	}
+
+	if *learnReject && *learnCommand != "" {
+		log.Fatal("--learn and --learn-reject cannot be used together")
+	}
+
+	if *recordFile != "" && *replayFile != "" {
+		log.Fatal("--record and --replay cannot be used together")
+	}
+
+	if *headless && *replayFile == "" {
+		log.Fatal("--headless can only be used with --replay")
+	}
+
+	if *printMatch && (*learnCommand != "" || *learnReject) {
+		log.Fatal("--print cannot be used while learning")
+	}
+
+	if *gesturesFile != "" {
+		config.SetPath(*gesturesFile)
+	}
+
+	if *learnSamples < 1 {
+		log.Fatalf("Invalid number of samples %d, must be at least 1", *learnSamples)
+	}
+
+	switch *rotation {
+	case models.RotationNone, models.RotationBounded, models.RotationFull:
+	default:
+		log.Fatalf("Invalid rotation %q, must be none, bounded or full", *rotation)
+	}
+
 	if *listGestures {
-		gestures, err := gestures.LoadGestures()
+		savedGestures, err := gestures.LoadGestures()
 		if err != nil {
 			log.Fatal("Failed to load gestures:", err)
 		}
-		if len(gestures) == 0 {
+		if len(savedGestures) == 0 {
 			println("No gestures registered")
 		} else {
 			println("Registered gestures:")
-			for _, g := range gestures {
-				println("  ", g.Command)
+			for _, g := range savedGestures {
+				if g.Reject {
+					println("   (rejection samples:", len(g.Templates), "template(s))")
+					continue
+				}
+				var details []string
+				if g.Direction != nil {
+					direction := stroke.DescribeDirection(*g.Direction)
+					if g.EnforceDirection {
+						direction += ", enforced"
+					}
+					details = append(details, direction)
+				}
+				if !g.IsEnabled() {
+					details = append(details, "disabled")
+				}
+				line := g.Label()
+				if len(details) > 0 {
+					line += " (" + strings.Join(details, ", ") + ")"
+				}
+				if len(g.Tags) > 0 {
+					line += " [" + strings.Join(g.Tags, ", ") + "]"
+				}
+				println("  ", line)
+				if g.Name != "" {
+					println("      command:", g.Command)
+				}
+				if g.Description != "" {
+					println("     ", g.Description)
+				}
 			}
 		}
 		return
 	}
 
-	if *removeGesture != "" {
-		gestures, err := gestures.LoadGestures()
-		if err != nil {
-			log.Fatal("Failed to load gestures:", err)
-		}
-
-		found := false
-		for i, g := range gestures {
-			if g.Command == *removeGesture {
-				gestures = append(gestures[:i], gestures[i+1:]...)
-				found = true
-				break
-			}
+	if *rollbackGesture != "" {
+		if err := adapt.Rollback(*rollbackGesture); err != nil {
+			log.Fatal("Failed to roll back gesture:", err)
 		}
+		println("Rolled back gesture:", *rollbackGesture)
+		return
+	}
 
-		if !found {
-			log.Fatalf("Gesture not found: %s", *removeGesture)
+	if *removeGesture != "" {
+		if err := gestures.Remove(*removeGesture); err != nil {
+			log.Fatal("Failed to remove gesture:", err)
 		}
+		println("Removed gesture:", *removeGesture)
+		return
+	}
 
-		configFile, err := config.GetPath()
+	var window window.Window
+	if !*headless {
+		waylandWindow, err := wayland.NewWaylandWindow()
 		if err != nil {
-			log.Fatal("Failed to get config path:", err)
+			log.Fatal("Failed to create Wayland window:", err)
 		}
-
-		data, err := json.Marshal(gestures)
+		window = waylandWindow
+	}
+	if *replayFile != "" {
+		replayer, err := record.NewReplayer(*replayFile, window)
 		if err != nil {
-			log.Fatal("Failed to marshal gestures:", err)
+			log.Fatal("Failed to load recording:", err)
 		}
-
-		if err := os.WriteFile(configFile, data, 0644); err != nil {
-			log.Fatal("Failed to save gestures:", err)
+		window = replayer
+		log.Printf("Replaying input from %s", *replayFile)
+	} else if *recordFile != "" {
+		recorder, err := record.NewRecorder(window, *recordFile)
+		if err != nil {
+			log.Fatal("Failed to start recording:", err)
 		}
-
-		println("Removed gesture:", *removeGesture)
-		return
-	}
-
-	window, err := wayland.NewWaylandWindow()
-	if err != nil {
-		log.Fatal("Failed to create Wayland window:", err)
+		window = recorder
+		log.Printf("Recording input to %s", *recordFile)
 	}
 	defer window.Destroy()
 
@@ -104,128 +248,68 @@ func main() {
 	}
 
 	app := &models.App{
-		StartTime: time.Now(),
-		Settings:  settings,
+		State:      models.StateIdle,
+		StartTime:  time.Now(),
+		Settings:   settings,
+		PrintMatch: *printMatch,
 	}
 
-	if *learnCommand != "" {
-		app.LearnMode = true
-		app.LearnCommand = *learnCommand
-		log.Printf("Learn mode: Draw the gesture 3 times for command '%s'", *learnCommand)
-	} else {
-		gestures, err := gestures.LoadGestures()
-		if err != nil {
-			log.Fatal("Failed to load gestures:", err)
-		}
-		app.SavedGestures = gestures
-		log.Printf("Loaded %d gesture(s)", len(gestures))
+	savedGestures, err := gestures.LoadGestures()
+	if err != nil {
+		log.Fatal("Failed to load gestures:", err)
 	}
-
-	opengl := opengl.New(app)
-	if err := opengl.InitGL(); err != nil {
-		log.Fatal("Failed to initialize OpenGL:", err)
+	for i := range savedGestures {
+		stroke.ForGesture(&savedGestures[i]).Prepare(&savedGestures[i])
 	}
-
-	gl.ClearColor(0, 0, 0, 0)
-
-	for range 5 {
-		window.PollEvents()
-		gl.Clear(gl.COLOR_BUFFER_BIT)
-		window.SwapBuffers()
+	app.SavedGestures = savedGestures
+	log.Printf("Loaded %d gesture(s)", len(savedGestures))
+
+	if *learnCommand != "" || *learnReject {
+		options := learn.Options{
+			Command:          *learnCommand,
+			Name:             *learnName,
+			Action:           action,
+			Reject:           *learnReject,
+			Samples:          *learnSamples,
+			Append:           *appendSamples,
+			Rotation:         *rotation,
+			StartDirection:   *startDirection,
+			EnforceDirection: *enforceDirection,
+		}
+		if err := learn.New(app).Start(options); err != nil {
+			log.Fatal("Failed to start learning:", err)
+		}
 	}
 
-	x, y := window.GetCursorPos()
-	app.LastCursorX = float32(x)
-	app.LastCursorY = float32(y)
-
-	lastTime := time.Now()
-	var wasPressed bool
-
-	for !window.ShouldClose() {
-		now := time.Now()
-		dt := float32(now.Sub(lastTime).Seconds())
-		lastTime = now
+	if !*headless {
+		opengl := opengl.New(app)
+		if err := opengl.InitGL(); err != nil {
+			log.Fatal("Failed to initialize OpenGL:", err)
+		}
 
-		window.PollEvents()
-		update := update.New(app)
-		update.UpdateCursor(window)
+		gl.ClearColor(0, 0, 0, 0)
 
-		if key, state, hasKey := window.GetLastKey(); hasKey {
-			if state == 1 && key == 0xff1b {
-				if !app.IsExiting {
-					if app.IsDrawing || len(app.Points) > 0 {
-						log.Println("Esc key pressed, aborting gesture")
-					} else {
-						log.Println("Esc key pressed, exiting")
-					}
-					app.IsExiting = true
-					app.ExitStartTime = time.Now()
-					app.Points = nil
-					window.DisableInput()
-					x, y := window.GetCursorPos()
-					spawn := spawn.New(app)
-					spawn.SpawnExitWisps(float32(x), float32(y))
-				}
-			}
-			window.ClearLastKey()
+		for range 5 {
+			window.PollEvents()
+			gl.Clear(gl.COLOR_BUFFER_BIT)
+			window.SwapBuffers()
 		}
+	}
 
-		if app.IsExiting {
-			if time.Since(app.ExitStartTime).Seconds() > 0.8 {
-				break
-			}
-		}
-		isPressed := window.GetMouseButton()
-		if isPressed && !wasPressed {
-			app.IsDrawing = true
-			log.Println("Gesture started")
-		} else if !isPressed && wasPressed {
-			app.IsDrawing = false
-
-			if app.LearnMode && len(app.Points) > 0 {
-				log.Println("Gesture completed")
-				processed := stroke.ProcessStroke(app.Points)
-				app.LearnGestures = append(app.LearnGestures, processed)
-				app.LearnCount++
-				log.Printf("Captured gesture %d/3", app.LearnCount)
-
-				app.Points = nil
-
-				if app.LearnCount >= 3 {
-					if err := gestures.SaveGesture(app.LearnCommand, app.LearnGestures); err != nil {
-						log.Fatal("Failed to save gesture:", err)
-					}
-					log.Printf("Gesture saved for command: %s", app.LearnCommand)
-
-					app.IsExiting = true
-					app.ExitStartTime = time.Now()
-					window.DisableInput()
-					x, y := window.GetCursorPos()
-					spawn := spawn.New(app)
-					spawn.SpawnExitWisps(float32(x), float32(y))
-				}
-			} else if !app.LearnMode && !app.IsExiting && len(app.Points) > 0 {
-				log.Println("Gesture completed")
-				x, y := window.GetCursorPos()
-				exec := execute.New(app)
-				exec.RecognizeAndExecute(window, float32(x), float32(y))
-				app.Points = nil
-			}
-		}
-		wasPressed = isPressed
+	loop := loop.New(app)
+	loop.Render = !*headless
+	loop.Run(window)
 
-		if app.IsDrawing {
-			x, y := window.GetCursorPos()
-			gesture := gestures.New(app)
-			gesture.AddPoint(float32(x), float32(y))
+	if app.Learn != nil && app.Learn.Err != nil {
+		window.Destroy()
+		os.Exit(1)
+	}
 
-			spawn := spawn.New(app)
-			spawn.SpawnCursorSparkles(float32(x), float32(y))
+	if *printMatch {
+		if app.MatchedCommand == "" {
+			window.Destroy()
+			os.Exit(1)
 		}
-
-		update.UpdateParticles(dt)
-		drawer := draw.New(app)
-		drawer.Draw(window)
-		window.SwapBuffers()
+		fmt.Println(app.MatchedCommand)
 	}
 }
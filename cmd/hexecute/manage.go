@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/adapt"
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	"github.com/ThatOtherAndrew/Hexecute/internal/execute"
+	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+)
+
+func runEdit(args []string) {
+	flags := flag.NewFlagSet("edit", flag.ExitOnError)
+	command := flags.String("command", "", "Run this command instead, replacing any action")
+	name := flags.String("name", "", "Show the gesture under this name, or under its command if empty")
+	description := flags.String("description", "", "Describe what the gesture does")
+	tags := flags.String("tags", "", "Comma-separated tags, replacing the existing ones")
+	gesturesFile := flags.String("gestures", "", "Edit gestures in this file instead of gestures.json")
+	actionFlags := addActionFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		log.Fatal("Usage: hexecute edit [flags] <gesture> [-- program args...]")
+	}
+	key := flags.Arg(0)
+	argv := flags.Args()[1:]
+	if len(argv) > 0 && argv[0] == "--" {
+		argv = argv[1:]
+	}
+	if len(argv) > 0 && !*actionFlags.exec {
+		log.Fatalf("Unknown arguments: %v", argv)
+	}
+
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if set["command"] && *command == "" {
+		log.Fatal("--command cannot be empty")
+	}
+
+	if *gesturesFile != "" {
+		config.SetPath(*gesturesFile)
+	}
+
+	var oldCommand, newCommand string
+	err := gestures.Update(key, func(gesture *models.GestureConfig) error {
+		if gesture.Reject {
+			return errors.New("rejection samples cannot be edited")
+		}
+		oldCommand = gesture.Command
+		if set["command"] {
+			gesture.Command = *command
+			gesture.Action = nil
+		}
+		newCommand = gesture.Command
+		if set["name"] {
+			gesture.Name = *name
+		}
+		if set["description"] {
+			gesture.Description = *description
+		}
+		if set["tags"] {
+			gesture.Tags = splitTags(*tags)
+		}
+
+		action, err := actionFlags.apply(execute.ActionFor(gesture), argv)
+		if err != nil {
+			return err
+		}
+		if action != nil {
+			gesture.Action = action
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal("Failed to edit gesture:", err)
+	}
+
+	if newCommand != oldCommand {
+		if err := adapt.Rename(oldCommand, newCommand); err != nil {
+			log.Printf("Failed to move adaptation history: %v", err)
+		}
+	}
+	println("Updated gesture:", key)
+}
+
+func runDuplicate(args []string) {
+	flags := flag.NewFlagSet("duplicate", flag.ExitOnError)
+	name := flags.String("name", "", "Show the new gesture under this name instead of its command")
+	gesturesFile := flags.String("gestures", "", "Edit gestures in this file instead of gestures.json")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatal("Usage: hexecute duplicate [flags] <gesture> <command>")
+	}
+	key, command := flags.Arg(0), flags.Arg(1)
+
+	if *gesturesFile != "" {
+		config.SetPath(*gesturesFile)
+	}
+
+	if err := gestures.Duplicate(key, command, *name); err != nil {
+		log.Fatal("Failed to duplicate gesture:", err)
+	}
+	println("Duplicated gesture", key, "for command:", command)
+}
+
+// runToggle enables or disables gestures, keeping their templates.
+func runToggle(args []string, enabled bool) {
+	verb, done := "enable", "Enabled"
+	if !enabled {
+		verb, done = "disable", "Disabled"
+	}
+	flags := flag.NewFlagSet(verb, flag.ExitOnError)
+	gesturesFile := flags.String("gestures", "", "Edit gestures in this file instead of gestures.json")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		log.Fatalf("Usage: hexecute %s [flags] <gesture>...", verb)
+	}
+
+	if *gesturesFile != "" {
+		config.SetPath(*gesturesFile)
+	}
+
+	for _, key := range flags.Args() {
+		err := gestures.Update(key, func(gesture *models.GestureConfig) error {
+			if enabled {
+				gesture.Enabled = nil
+			} else {
+				gesture.Enabled = &enabled
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Failed to %s gesture: %v", verb, err)
+		}
+		println(done, "gesture:", key)
+	}
+}
+
+func splitTags(value string) []string {
+	var tags []string
+	for tag := range strings.SplitSeq(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	list := flags.Bool("list", false, "List the available backups instead of restoring one")
+	gesturesFile := flags.String("gestures", "", "Restore this file instead of gestures.json")
+	flags.Parse(args)
+
+	if flags.NArg() > 1 {
+		log.Fatal("Usage: hexecute restore [flags] [backup]")
+	}
+
+	if *gesturesFile != "" {
+		config.SetPath(*gesturesFile)
+	}
+
+	configFile, err := config.GetPath()
+	if err != nil {
+		log.Fatal("Failed to get config path:", err)
+	}
+
+	if *list {
+		backups := config.Backups(configFile)
+		if len(backups) == 0 {
+			println("No backups of", configFile)
+			return
+		}
+		println("Backups, most recent first:")
+		for i, backup := range backups {
+			info, err := os.Stat(backup)
+			if err != nil {
+				continue
+			}
+			println("  ", i+1, info.ModTime().Format(time.DateTime), backup)
+		}
+		return
+	}
+
+	n := 1
+	if flags.NArg() == 1 {
+		n, err = strconv.Atoi(flags.Arg(0))
+		if err != nil {
+			log.Fatalf("Invalid backup %q, must be a number", flags.Arg(0))
+		}
+	}
+
+	if err := gestures.Restore(n); err != nil {
+		log.Fatal("Failed to restore gestures:", err)
+	}
+	println("Restored gestures from backup", n)
+}
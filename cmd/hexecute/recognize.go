@@ -0,0 +1,114 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	"github.com/ThatOtherAndrew/Hexecute/internal/execute"
+	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
+)
+
+func runRecognize(args []string) {
+	flags := flag.NewFlagSet("recognize", flag.ExitOnError)
+	input := flags.String("input", "-", "JSON file holding the drawn points, or - for stdin")
+	run := flags.Bool("execute", false, "Execute the command of the matched gesture")
+	gesturesFile := flags.String("gestures", "", "Read gestures from this file instead of gestures.json")
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		log.Fatalf("Unknown arguments: %v", flags.Args())
+	}
+
+	if *gesturesFile != "" {
+		config.SetPath(*gesturesFile)
+	}
+
+	strokes, err := readStrokes(*input)
+	if err != nil {
+		log.Fatal("Failed to read input:", err)
+	}
+
+	points, starts := stroke.JoinStrokes(strokes)
+	if len(points) < 5 {
+		log.Fatal("Gesture too short")
+	}
+
+	settings, err := config.LoadSettings()
+	if err != nil {
+		log.Fatal("Failed to load settings:", err)
+	}
+
+	savedGestures, err := gestures.LoadGestures()
+	if err != nil {
+		log.Fatal("Failed to load gestures:", err)
+	}
+	for i := range savedGestures {
+		stroke.ForGesture(&savedGestures[i]).Prepare(&savedGestures[i])
+	}
+
+	result := execute.Recognize(savedGestures, points, starts, float64(settings.AmbiguityMargin))
+
+	ranked := slices.Clone(result.Matches)
+	slices.SortStableFunc(ranked, func(a, b stroke.Match) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	for _, m := range ranked {
+		gesture := savedGestures[m.Gesture]
+		label := gesture.Label()
+		if gesture.Reject {
+			label = "(rejection samples)"
+		}
+		if !gesture.IsEnabled() {
+			label += " (disabled)"
+		}
+		fmt.Printf("%.3f\t%s\n", m.Score, label)
+	}
+
+	if result.Outcome != execute.OutcomeMatched {
+		fmt.Println("Result:", result.Outcome)
+		os.Exit(1)
+	}
+
+	gesture := &savedGestures[result.Best]
+	fmt.Println("Result:", result.Outcome, gesture.Command)
+	if *run {
+		if err := execute.Run(execute.ActionFor(gesture)); err != nil {
+			log.Fatal("Failed to execute command:", err)
+		}
+	}
+}
+
+// readStrokes reads a drawn gesture as either a list of points or a list of
+// strokes, each a list of points.
+func readStrokes(path string) ([][]models.Point, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var strokes [][]models.Point
+	if err := json.Unmarshal(data, &strokes); err == nil {
+		return strokes, nil
+	}
+
+	var points []models.Point
+	if err := json.Unmarshal(data, &points); err != nil {
+		return nil, err
+	}
+	return [][]models.Point{points}, nil
+}
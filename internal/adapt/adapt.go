@@ -0,0 +1,235 @@
+package adapt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
+)
+
+// refreshInterval is how many accepted strokes are collected for a gesture
+// before its templates are refreshed from them.
+const refreshInterval = 5
+
+// maxSnapshots is how many previous template sets are kept for rollback.
+const maxSnapshots = 5
+
+type Snapshot struct {
+	Time      time.Time        `json:"time"`
+	Templates [][]models.Point `json:"templates"`
+	Strokes   [][]int          `json:"strokes,omitempty"`
+}
+
+type GestureHistory struct {
+	Accepted        [][]models.Point `json:"accepted"`
+	AcceptedStrokes [][]int          `json:"accepted_strokes,omitempty"`
+	Snapshots       []Snapshot       `json:"snapshots"`
+}
+
+type History map[string]*GestureHistory
+
+func LoadHistory() (History, error) {
+	historyFile, err := config.GetHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(historyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return History{}, nil
+		}
+		return nil, err
+	}
+
+	history := History{}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func SaveHistory(history History) error {
+	historyFile, err := config.GetHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	return config.WriteFile(historyFile, data)
+}
+
+// Record stores a stroke that was accepted as gesture, and once enough have
+// been collected, refreshes the gesture's templates from them.
+func Record(gesture models.GestureConfig, points []models.Point, starts []int, maxTemplates int) error {
+	// Multistroke drawings are matched with $P, so they can only be learned
+	// from by gestures whose templates are point clouds too.
+	recognizer := stroke.ForGesture(&gesture)
+	if len(starts) > 1 && recognizer.Name() != config.RecognizerPointCloud {
+		return nil
+	}
+
+	unlock, err := lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	history, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+
+	h := history[gesture.Command]
+	if h == nil {
+		h = &GestureHistory{}
+		history[gesture.Command] = h
+	}
+
+	template, templateStarts := recognizer.PreprocessTemplate(points, starts)
+	if !stroke.IsFinite(template) {
+		return nil
+	}
+	h.Accepted = append(h.Accepted, template)
+	if templateStarts != nil {
+		h.AcceptedStrokes = append(h.AcceptedStrokes, templateStarts)
+	}
+
+	if len(h.Accepted) >= refreshInterval {
+		if err := refresh(gesture.Command, history, maxTemplates); err != nil {
+			return err
+		}
+	}
+
+	return SaveHistory(history)
+}
+
+// refresh adds the strokes accepted for a gesture to its saved templates. The
+// gesture is read back from the gestures file, as it may have changed since
+// it was loaded; if it no longer exists, its history is dropped.
+func refresh(command string, history History, maxTemplates int) error {
+	h := history[command]
+
+	saved, err := gestures.LoadGestures()
+	if err != nil {
+		return err
+	}
+	if gestures.Find(saved, command) < 0 {
+		delete(history, command)
+		return nil
+	}
+
+	err = gestures.Update(command, func(gesture *models.GestureConfig) error {
+		h.Snapshots = append(h.Snapshots, Snapshot{
+			Time:      time.Now(),
+			Templates: gesture.Templates,
+			Strokes:   gesture.Strokes,
+		})
+		if len(h.Snapshots) > maxSnapshots {
+			h.Snapshots = h.Snapshots[len(h.Snapshots)-maxSnapshots:]
+		}
+
+		gesture.Templates = append(slices.Clone(gesture.Templates), h.Accepted...)
+		gesture.Strokes = append(slices.Clone(gesture.Strokes), h.AcceptedStrokes...)
+		gesture.Vectors = nil
+		gesture.Prefixes = nil
+		gestures.PruneTemplates(gesture, maxTemplates)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.Accepted = nil
+	h.AcceptedStrokes = nil
+	return nil
+}
+
+// Rollback restores the templates a gesture had before its last refresh, and
+// discards any strokes accepted since. The gesture is found by name or command.
+func Rollback(key string) error {
+	unlock, err := lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	history, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+
+	saved, err := gestures.LoadGestures()
+	if err != nil {
+		return err
+	}
+	index := gestures.Find(saved, key)
+	if index < 0 {
+		return fmt.Errorf("gesture not found: %s", key)
+	}
+	command := saved[index].Command
+
+	h := history[command]
+	if h == nil || len(h.Snapshots) == 0 {
+		return fmt.Errorf("no adaptation history for %q", key)
+	}
+
+	snapshot := h.Snapshots[len(h.Snapshots)-1]
+	err = gestures.Update(command, func(gesture *models.GestureConfig) error {
+		gesture.Templates = snapshot.Templates
+		gesture.Strokes = snapshot.Strokes
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.Snapshots = h.Snapshots[:len(h.Snapshots)-1]
+	h.Accepted = nil
+	h.AcceptedStrokes = nil
+
+	return SaveHistory(history)
+}
+
+// Rename moves the adaptation history of a gesture whose command has changed.
+func Rename(command, newCommand string) error {
+	unlock, err := lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	history, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+
+	h := history[command]
+	if h == nil {
+		return nil
+	}
+	delete(history, command)
+	history[newCommand] = h
+
+	return SaveHistory(history)
+}
+
+// lockHistory locks the history file while it is read, changed and written
+// back, so that the daemon and other instances don't lose each other's
+// changes. It is always taken before the gestures file lock.
+func lockHistory() (unlock func(), err error) {
+	historyFile, err := config.GetHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	return config.Lock(historyFile)
+}
@@ -0,0 +1,221 @@
+package analyze
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/execute"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
+)
+
+// rejectLabel names the rejection samples in reports, as they have no command.
+const rejectLabel = "(rejection samples)"
+
+// noneLabel names the confusion matrix column for templates that matched no
+// gesture confidently.
+const noneLabel = "(none)"
+
+type GestureReport struct {
+	Command   string  `json:"command"`
+	Templates int     `json:"templates"`
+	Tested    int     `json:"tested"`
+	Correct   int     `json:"correct"`
+	Accuracy  float64 `json:"accuracy"`
+}
+
+// Pair is the two distinct gestures that are hardest to tell apart. Margin is
+// the smallest lead any template had over the other gesture, between its score
+// against the rest of its own gesture and its score against the other one.
+type Pair struct {
+	A      string  `json:"a"`
+	B      string  `json:"b"`
+	Score  float64 `json:"score"`
+	Margin float64 `json:"margin"`
+}
+
+type Report struct {
+	Gestures []GestureReport `json:"gestures"`
+	Labels   []string        `json:"labels"`
+	// Confusion counts templates by drawn gesture (rows) and recognised
+	// gesture (columns), with a final column for no confident match.
+	Confusion   [][]int `json:"confusion"`
+	ClosestPair *Pair   `json:"closest_pair,omitempty"`
+}
+
+// Analyze runs leave-one-out cross-validation over the saved gestures: every
+// template is recognised against all gestures, with itself left out of its
+// own. Gestures with a single template can't be tested this way, but are
+// still scored against.
+func Analyze(saved []models.GestureConfig) Report {
+	report := Report{
+		Gestures:  make([]GestureReport, len(saved)),
+		Confusion: make([][]int, len(saved)),
+	}
+	for i := range saved {
+		report.Labels = append(report.Labels, label(saved[i]))
+		report.Confusion[i] = make([]int, len(saved)+1)
+		report.Gestures[i] = GestureReport{
+			Command:   report.Labels[i],
+			Templates: len(saved[i].Templates),
+		}
+	}
+	report.Labels = append(report.Labels, noneLabel)
+
+	// margins[a][b] is the smallest lead a template of a had over b.
+	margins := make([][]float64, len(saved))
+	scores := make([][]float64, len(saved))
+	for i := range saved {
+		margins[i] = make([]float64, len(saved))
+		scores[i] = make([]float64, len(saved))
+		for j := range margins[i] {
+			margins[i][j] = math.Inf(1)
+		}
+	}
+
+	for i := range saved {
+		gesture := &saved[i]
+		if len(gesture.Templates) < 2 {
+			continue
+		}
+		hasStrokes := len(gesture.Strokes) == len(gesture.Templates)
+
+		for t, template := range gesture.Templates {
+			var starts []int
+			if hasStrokes {
+				starts = gesture.Strokes[t]
+			}
+
+			others := withoutTemplate(saved, i, t)
+			matches := stroke.ScoreAll(template, starts, others)
+
+			predicted := len(saved)
+			bestScore := 0.0
+			for _, m := range matches {
+				if m.Score > bestScore {
+					bestScore = m.Score
+					predicted = m.Gesture
+				}
+			}
+			if predicted < len(saved) && bestScore <= execute.Threshold(&saved[predicted]) {
+				predicted = len(saved)
+			}
+
+			report.Confusion[i][predicted]++
+			report.Gestures[i].Tested++
+			if predicted == i {
+				report.Gestures[i].Correct++
+			}
+
+			own := matches[i].Score
+			for _, m := range matches {
+				if m.Gesture == i {
+					continue
+				}
+				margins[i][m.Gesture] = min(margins[i][m.Gesture], own-m.Score)
+				scores[i][m.Gesture] = max(scores[i][m.Gesture], m.Score)
+			}
+		}
+
+		if report.Gestures[i].Tested > 0 {
+			report.Gestures[i].Accuracy =
+				float64(report.Gestures[i].Correct) / float64(report.Gestures[i].Tested)
+		}
+	}
+
+	for a := range saved {
+		for b := a + 1; b < len(saved); b++ {
+			margin := min(margins[a][b], margins[b][a])
+			if math.IsInf(margin, 1) {
+				continue
+			}
+			if report.ClosestPair == nil || margin < report.ClosestPair.Margin {
+				report.ClosestPair = &Pair{
+					A:      report.Labels[a],
+					B:      report.Labels[b],
+					Score:  max(scores[a][b], scores[b][a]),
+					Margin: margin,
+				}
+			}
+		}
+	}
+
+	return report
+}
+
+// WriteText prints the report as human-readable tables. Confusion matrix
+// columns are numbered after the rows, to stay narrow with many gestures.
+func (r Report) WriteText(w io.Writer) error {
+	width := len(noneLabel)
+	for _, g := range r.Gestures {
+		width = max(width, len(g.Command))
+	}
+
+	fmt.Fprintf(w, "%-*s  %9s  %6s  %8s\n", width, "Gesture", "Templates", "Tested", "Accuracy")
+	for _, g := range r.Gestures {
+		accuracy := "-"
+		if g.Tested > 0 {
+			accuracy = fmt.Sprintf("%.1f%%", g.Accuracy*100)
+		}
+		fmt.Fprintf(w, "%-*s  %9d  %6d  %8s\n", width, g.Command, g.Templates, g.Tested, accuracy)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Confusion matrix (rows: drawn, columns: recognised):")
+	fmt.Fprintf(w, "%*s", width+5, "")
+	for j := range r.Labels {
+		fmt.Fprintf(w, " %3d", j+1)
+	}
+	fmt.Fprintln(w)
+	for i, row := range r.Confusion {
+		fmt.Fprintf(w, "%3d  %-*s", i+1, width, r.Labels[i])
+		for _, count := range row {
+			fmt.Fprintf(w, " %3d", count)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%3d  %s\n", len(r.Labels), noneLabel)
+
+	fmt.Fprintln(w)
+	if r.ClosestPair == nil {
+		_, err := fmt.Fprintln(w, "Closest pair: not enough templates to compare")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Closest pair: %s and %s (score: %.3f, margin: %.3f)\n",
+		r.ClosestPair.A, r.ClosestPair.B, r.ClosestPair.Score, r.ClosestPair.Margin)
+	return err
+}
+
+func (r Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// withoutTemplate returns a copy of saved with template t of gesture i left out.
+func withoutTemplate(saved []models.GestureConfig, i, t int) []models.GestureConfig {
+	others := slices.Clone(saved)
+
+	gesture := saved[i]
+	gesture.Templates = slices.Delete(slices.Clone(gesture.Templates), t, t+1)
+	if len(gesture.Strokes) == len(saved[i].Templates) {
+		gesture.Strokes = slices.Delete(slices.Clone(gesture.Strokes), t, t+1)
+	}
+	gesture.Vectors = nil
+	gesture.Prefixes = nil
+	others[i] = gesture
+	return others
+}
+
+func label(gesture models.GestureConfig) string {
+	if gesture.Reject {
+		return rejectLabel
+	}
+	return gesture.Label()
+}
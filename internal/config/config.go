@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
@@ -11,10 +12,33 @@ import (
 
 // TODO: migrate other settings
 type Settings struct {
-	OverlayAlpha float32 `json:"overlay_alpha"`
+	OverlayAlpha    float32 `json:"overlay_alpha"`
+	Recognizer      string  `json:"recognizer"`
+	Multistroke     bool    `json:"multistroke"`
+	StrokeTimeout   float32 `json:"stroke_timeout"`
+	AmbiguityMargin float32 `json:"ambiguity_margin"`
+	MaxTemplates    int     `json:"max_templates"`
+	Adaptive        bool    `json:"adaptive"`
+}
+
+const (
+	RecognizerUnistroke  = "unistroke"
+	RecognizerProtractor = "protractor"
+	RecognizerPointCloud = "pointcloud"
+)
+
+// gesturesPath overrides the location of gestures.json when set.
+var gesturesPath string
+
+// SetPath makes GetPath return path instead of the default gestures.json.
+func SetPath(path string) {
+	gesturesPath = path
 }
 
 func GetPath() (string, error) {
+	if gesturesPath != "" {
+		return gesturesPath, nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -38,6 +62,34 @@ func GetSettingsPath() (string, error) {
 	return filepath.Join(configDir, "settings.json"), nil
 }
 
+// GetHistoryPath returns the path of the adaptation history for the gestures
+// file in use: history.json next to the default gestures.json, or
+// <name>.history.json next to a file set with SetPath, as the history is
+// keyed by command and each file has its own gestures.
+func GetHistoryPath() (string, error) {
+	if gesturesPath != "" {
+		return strings.TrimSuffix(gesturesPath, ".json") + ".history.json", nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	configDir := filepath.Join(homeDir, ".config", "hexecute")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "history.json"), nil
+}
+
+// GetSocketPath returns the path of the socket the daemon listens on.
+func GetSocketPath() (string, error) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return "", errors.New("XDG_RUNTIME_DIR is not set")
+	}
+	return filepath.Join(runtimeDir, "hexecute.sock"), nil
+}
+
 func LoadSettings() (*Settings, error) {
 	settingsPath, err := GetSettingsPath()
 	if err != nil {
@@ -45,7 +97,13 @@ func LoadSettings() (*Settings, error) {
 	}
 
 	defaultSettings := &Settings{
-		OverlayAlpha: 0.75,
+		OverlayAlpha:    0.75,
+		Recognizer:      RecognizerUnistroke,
+		Multistroke:     false,
+		StrokeTimeout:   0.5,
+		AmbiguityMargin: 0.05,
+		MaxTemplates:    10,
+		Adaptive:        false,
 	}
 
 	data, err := os.ReadFile(settingsPath)
@@ -75,6 +133,7 @@ func LoadSettings() (*Settings, error) {
 	}
 
 	settings := &Settings{}
+	*settings = *defaultSettings
 	if err := json.Unmarshal(data, settings); err != nil {
 		log.Printf("Invalid settings file, using defaults: %v", err)
 		return defaultSettings, nil
@@ -87,6 +146,33 @@ func LoadSettings() (*Settings, error) {
 		settings.OverlayAlpha = defaultSettings.OverlayAlpha
 	}
 
+	switch settings.Recognizer {
+	case RecognizerUnistroke, RecognizerProtractor, RecognizerPointCloud:
+	default:
+		log.Printf("Invalid recognizer '%s', must be '%s', '%s' or '%s', using default '%s'",
+			settings.Recognizer, RecognizerUnistroke, RecognizerProtractor, RecognizerPointCloud,
+			defaultSettings.Recognizer)
+		settings.Recognizer = defaultSettings.Recognizer
+	}
+
+	if settings.StrokeTimeout <= 0 {
+		log.Printf("Invalid stroke_timeout value %.2f, must be greater than 0.0, using default %.2f",
+			settings.StrokeTimeout, defaultSettings.StrokeTimeout)
+		settings.StrokeTimeout = defaultSettings.StrokeTimeout
+	}
+
+	if settings.AmbiguityMargin < 0.0 || settings.AmbiguityMargin > 1.0 {
+		log.Printf("Invalid ambiguity_margin value %.2f, must be between 0.0 and 1.0, using default %.2f",
+			settings.AmbiguityMargin, defaultSettings.AmbiguityMargin)
+		settings.AmbiguityMargin = defaultSettings.AmbiguityMargin
+	}
+
+	if settings.MaxTemplates < 1 {
+		log.Printf("Invalid max_templates value %d, must be at least 1, using default %d",
+			settings.MaxTemplates, defaultSettings.MaxTemplates)
+		settings.MaxTemplates = defaultSettings.MaxTemplates
+	}
+
 	return settings, nil
 }
 
@@ -95,7 +181,18 @@ func createDefaultSettings(path string, settings *Settings) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+
+	unlock, err := Lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Another instance may have created it while waiting for the lock.
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return WriteFile(path, data)
 }
 
 func getKnownKeys(v interface{}) map[string]bool {
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// maxBackups is how many previous versions of a file Backup keeps.
+const maxBackups = 5
+
+// Lock takes an advisory lock for path, waiting until no other process holds
+// it, so that reading, changing and writing the file back isn't interleaved
+// with another writer. The lock is on a separate file, as WriteFile replaces
+// path itself.
+func Lock(path string) (unlock func(), err error) {
+	file, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// WriteFile replaces path with data atomically: data is synced to a temporary
+// file that is then renamed over path, so a crash leaves either the old or the
+// new contents, never a mix.
+func WriteFile(path string, data []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	temp, err := os.CreateTemp(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(0644); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+
+	// Sync the directory too, so the rename itself survives a crash.
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+	return dirFile.Sync()
+}
+
+// Backup keeps a copy of the current contents of path before it is
+// overwritten with data. Backups are numbered from 1, the most recent, and
+// the oldest is dropped once there are maxBackups of them. Nothing is backed
+// up if path doesn't exist yet or already holds data.
+func Backup(path string, data []byte) error {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if bytes.Equal(current, data) {
+		return nil
+	}
+
+	for n := maxBackups - 1; n >= 1; n-- {
+		err := os.Rename(BackupPath(path, n), BackupPath(path, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return WriteFile(BackupPath(path, 1), current)
+}
+
+// BackupPath returns the path of backup n of path, counting from 1 for the
+// most recent.
+func BackupPath(path string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// Backups returns the paths of the backups of path that exist, most recent
+// first.
+func Backups(path string) []string {
+	var backups []string
+	for n := 1; n <= maxBackups; n++ {
+		if _, err := os.Stat(BackupPath(path, n)); err == nil {
+			backups = append(backups, BackupPath(path, n))
+		}
+	}
+	return backups
+}
+
+// ReadBackup returns the contents of backup n of path.
+func ReadBackup(path string, n int) ([]byte, error) {
+	if n < 1 || n > maxBackups {
+		return nil, fmt.Errorf("invalid backup %d, must be between 1 and %d", n, maxBackups)
+	}
+	data, err := os.ReadFile(BackupPath(path, n))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no backup %d of %s", n, path)
+	}
+	return data, err
+}
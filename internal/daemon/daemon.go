@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	"github.com/ThatOtherAndrew/Hexecute/internal/learn"
+)
+
+const (
+	RequestShow   = "show"
+	RequestLearn  = "learn"
+	RequestReload = "reload"
+	RequestQuit   = "quit"
+)
+
+type Request struct {
+	Type  string         `json:"type"`
+	Learn *learn.Options `json:"learn,omitempty"`
+}
+
+type Response struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Call is a request waiting to be handled by the daemon. The client is
+// answered once Reply is called.
+type Call struct {
+	Request Request
+	reply   chan error
+}
+
+func (c *Call) Reply(err error) {
+	c.reply <- err
+}
+
+type Server struct {
+	listener net.Listener
+	path     string
+	// Calls receives every request, so that they are handled on the thread
+	// that owns the window.
+	Calls chan *Call
+}
+
+// Listen creates the daemon's socket, replacing a stale one left behind by a
+// daemon that didn't shut down cleanly.
+func Listen() (*Server, error) {
+	path, err := config.GetSocketPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, errors.New("daemon is already running")
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{listener: listener, path: path, Calls: make(chan *Call)}, nil
+}
+
+// Serve accepts clients until the server is closed.
+func (s *Server) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Failed to accept client: %v", err)
+			}
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var request Request
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		// Listen probes for a running daemon without sending anything.
+		if !errors.Is(err, io.EOF) {
+			log.Printf("Invalid request: %v", err)
+		}
+		return
+	}
+
+	call := &Call{Request: request, reply: make(chan error, 1)}
+	s.Calls <- call
+
+	response := Response{}
+	if err := <-call.reply; err != nil {
+		response.Error = err.Error()
+	}
+	if err := json.NewEncoder(conn).Encode(response); err != nil {
+		log.Printf("Failed to answer client: %v", err)
+	}
+}
+
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	if removeErr := os.Remove(s.path); removeErr != nil && !os.IsNotExist(removeErr) {
+		err = errors.Join(err, removeErr)
+	}
+	return err
+}
+
+// Send makes a request to the running daemon and waits for its answer.
+func Send(request Request) error {
+	path, err := config.GetSocketPath()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("no daemon running, start one with 'hexecute daemon': %w", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return err
+	}
+
+	var response Response
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
@@ -1,11 +1,11 @@
 package draw
 
 import (
+	"fmt"
 	"math"
-	"time"
 
 	"github.com/ThatOtherAndrew/Hexecute/internal/models"
-	"github.com/ThatOtherAndrew/Hexecute/pkg/wayland"
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
 	"github.com/go-gl/gl/v4.1-core/gl"
 )
 
@@ -17,10 +17,10 @@ func New(app *models.App) *App {
 	return &App{app: app}
 }
 
-func (a *App) Draw(window *wayland.WaylandWindow) {
+func (a *App) Draw(window window.Window) {
 	gl.Clear(gl.COLOR_BUFFER_BIT)
 
-	currentTime := float32(time.Since(a.app.StartTime).Seconds())
+	currentTime := float32(a.app.Now.Sub(a.app.StartTime).Seconds())
 
 	a.drawBackground(currentTime, window)
 
@@ -34,51 +34,71 @@ func (a *App) Draw(window *wayland.WaylandWindow) {
 	}
 
 	a.drawParticles(window)
+	a.drawPreview(window, float32(x), float32(y))
+	a.drawLearnProgress(window, float32(x), float32(y))
 }
 
+// drawLine draws the stroke being drawn, and while a multistroke gesture is
+// in progress, the strokes already finished.
 func (a *App) drawLine(
-	window *wayland.WaylandWindow,
+	window window.Window,
 	baseThickness, baseAlpha, currentTime float32,
 ) {
-	if len(a.app.Points) < 2 {
+	if a.app.State == models.StateDrawing || a.app.State == models.StateRecognizing {
+		for _, stroke := range a.app.Strokes {
+			a.drawStroke(window, stroke, false, baseThickness, baseAlpha, currentTime)
+		}
+	}
+
+	a.drawStroke(window, a.app.Points, true, baseThickness, baseAlpha, currentTime)
+}
+
+// drawStroke draws points as a line. With fade set, older points fade out
+// as the line trails behind the cursor.
+func (a *App) drawStroke(
+	window window.Window,
+	points []models.Point,
+	fade bool,
+	baseThickness, baseAlpha, currentTime float32,
+) {
+	if len(points) < 2 {
 		return
 	}
 
-	vertices := make([]float32, 0, len(a.app.Points)*10)
+	vertices := make([]float32, 0, len(points)*10)
 
-	for i := range a.app.Points {
-		age := float32(time.Since(a.app.Points[i].BornTime).Seconds())
-		fade := 1.0 - (age / 1.5)
-		if fade < 0 {
-			fade = 0
+	for i := range points {
+		alpha := baseAlpha
+		if fade {
+			age := float32(a.app.Now.Sub(points[i].BornTime).Seconds())
+			alpha *= max(0, 1.0-(age/1.5))
 		}
-		alpha := fade * baseAlpha
 
 		var perpX, perpY float32
 
 		if i == 0 {
-			dx := a.app.Points[i+1].X - a.app.Points[i].X
-			dy := a.app.Points[i+1].Y - a.app.Points[i].Y
+			dx := points[i+1].X - points[i].X
+			dy := points[i+1].Y - points[i].Y
 			length := float32(1.0) / float32(math.Sqrt(float64(dx*dx+dy*dy)))
 			perpX = -dy * length
 			perpY = dx * length
-		} else if i == len(a.app.Points)-1 {
-			dx := a.app.Points[i].X - a.app.Points[i-1].X
-			dy := a.app.Points[i].Y - a.app.Points[i-1].Y
+		} else if i == len(points)-1 {
+			dx := points[i].X - points[i-1].X
+			dy := points[i].Y - points[i-1].Y
 			length := float32(1.0) / float32(math.Sqrt(float64(dx*dx+dy*dy)))
 			perpX = -dy * length
 			perpY = dx * length
 		} else {
-			dx1 := a.app.Points[i].X - a.app.Points[i-1].X
-			dy1 := a.app.Points[i].Y - a.app.Points[i-1].Y
+			dx1 := points[i].X - points[i-1].X
+			dy1 := points[i].Y - points[i-1].Y
 			len1 := float32(math.Sqrt(float64(dx1*dx1 + dy1*dy1)))
 			if len1 > 0 {
 				dx1 /= len1
 				dy1 /= len1
 			}
 
-			dx2 := a.app.Points[i+1].X - a.app.Points[i].X
-			dy2 := a.app.Points[i+1].Y - a.app.Points[i].Y
+			dx2 := points[i+1].X - points[i].X
+			dy2 := points[i+1].Y - points[i].Y
 			len2 := float32(math.Sqrt(float64(dx2*dx2 + dy2*dy2)))
 			if len2 > 0 {
 				dx2 /= len2
@@ -97,13 +117,8 @@ func (a *App) drawLine(
 			perpY = avgDx
 		}
 
-		vertices = append(vertices, a.app.Points[i].X, a.app.Points[i].Y, perpX, perpY, alpha)
-		vertices = append(vertices, a.app.Points[i].X, a.app.Points[i].Y, -perpX, -perpY, alpha)
-	}
-
-	cutoff := time.Now().Add(-1500 * time.Millisecond)
-	for len(a.app.Points) > 0 && a.app.Points[0].BornTime.Before(cutoff) {
-		a.app.Points = a.app.Points[1:]
+		vertices = append(vertices, points[i].X, points[i].Y, perpX, perpY, alpha)
+		vertices = append(vertices, points[i].X, points[i].Y, -perpX, -perpY, alpha)
 	}
 
 	if len(vertices) == 0 {
@@ -124,11 +139,11 @@ func (a *App) drawLine(
 	gl.Uniform1f(timeLoc, currentTime)
 
 	gl.BindVertexArray(a.app.Vao)
-	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, int32(len(a.app.Points)*2))
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, int32(len(points)*2))
 	gl.BindVertexArray(0)
 }
 
-func (a *App) drawParticles(window *wayland.WaylandWindow) {
+func (a *App) drawParticles(window window.Window) {
 	if len(a.app.Particles) == 0 {
 		return
 	}
@@ -152,7 +167,7 @@ func (a *App) drawParticles(window *wayland.WaylandWindow) {
 	gl.BindVertexArray(0)
 }
 
-func (a *App) drawBackground(currentTime float32, window *wayland.WaylandWindow) {
+func (a *App) drawBackground(currentTime float32, window window.Window) {
 	fadeDuration := float32(1.0)
 	targetAlpha := a.app.Settings.OverlayAlpha
 
@@ -165,9 +180,9 @@ func (a *App) drawBackground(currentTime float32, window *wayland.WaylandWindow)
 		alpha = targetAlpha
 	}
 
-	if a.app.IsExiting {
+	if a.app.State == models.StateExiting {
 		exitDuration := float32(0.8)
-		elapsed := float32(time.Since(a.app.ExitStartTime).Seconds())
+		elapsed := float32(a.app.Now.Sub(a.app.StateTime).Seconds())
 		if elapsed < exitDuration {
 			progress := elapsed / exitDuration
 			easedProgress := 1.0 - (1.0-progress)*(1.0-progress)*(1.0-progress)*(1.0-progress)*(1.0-progress)
@@ -200,7 +215,7 @@ func (a *App) drawBackground(currentTime float32, window *wayland.WaylandWindow)
 	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE)
 }
 
-func (a *App) drawCursorGlow(window *wayland.WaylandWindow, cursorX, cursorY, currentTime float32) {
+func (a *App) drawCursorGlow(window window.Window, cursorX, cursorY, currentTime float32) {
 	width, height := window.GetSize()
 
 	growDuration := float32(1.2)
@@ -220,9 +235,9 @@ func (a *App) drawCursorGlow(window *wayland.WaylandWindow, cursorX, cursorY, cu
 	}
 
 	var exitProgress float32
-	if a.app.IsExiting {
+	if a.app.State == models.StateExiting {
 		exitDuration := float32(0.8)
-		elapsed := float32(time.Since(a.app.ExitStartTime).Seconds())
+		elapsed := float32(a.app.Now.Sub(a.app.StateTime).Seconds())
 		if elapsed < exitDuration {
 			t := elapsed / exitDuration
 			exitProgress = t * t * t
@@ -263,3 +278,36 @@ func (a *App) drawCursorGlow(window *wayland.WaylandWindow, cursorX, cursorY, cu
 	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
 	gl.BindVertexArray(0)
 }
+
+func (a *App) drawPreview(window window.Window, cursorX, cursorY float32) {
+	if a.app.PreviewCommand == "" || a.app.State == models.StateExiting {
+		return
+	}
+
+	a.drawText(window, truncate(a.app.PreviewCommand, 40), cursorX+24, cursorY+24, 0.55, 1.0)
+}
+
+func (a *App) drawLearnProgress(window window.Window, cursorX, cursorY float32) {
+	session := a.app.Learn
+	if session == nil || a.app.State == models.StateExiting {
+		return
+	}
+
+	if a.app.State == models.StateConfirming {
+		a.drawText(window, "Conflicts with: "+truncate(session.Conflict, 40), cursorX+24, cursorY+24, 0.1, 1.0)
+		a.drawText(window, "Enter: save  R: redraw  Esc: cancel", cursorX+24, cursorY+52, 0.55, 1.0)
+		return
+	}
+
+	progress := fmt.Sprintf("%d/%d", session.Count(), session.Samples)
+	a.drawText(window, progress, cursorX+24, cursorY+24, 0.55, 1.0)
+
+	if session.Hint == "" {
+		return
+	}
+	hintDuration := float32(1.5)
+	elapsed := float32(a.app.Now.Sub(session.HintTime).Seconds())
+	if elapsed < hintDuration {
+		a.drawText(window, session.Hint, cursorX+24, cursorY+52, 0.1, 1.0-elapsed/hintDuration)
+	}
+}
@@ -0,0 +1,60 @@
+package draw
+
+import (
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+const (
+	textDotPitch = 3.0
+	textDotSize  = 5.0
+)
+
+// drawText renders text as glowing dots with the particle program, with its
+// top-left corner at (x, y).
+func (a *App) drawText(window window.Window, text string, x, y, hue, alpha float32) {
+	if text == "" || alpha <= 0 {
+		return
+	}
+
+	vertices := make([]float32, 0, len(text)*35*6)
+	penX := x
+	for _, c := range text {
+		for col, bits := range glyph(c) {
+			for row := range 7 {
+				if bits&(1<<row) == 0 {
+					continue
+				}
+				vertices = append(vertices,
+					penX+float32(col)*textDotPitch, y+float32(row)*textDotPitch,
+					alpha, 1, textDotSize, hue)
+			}
+		}
+		penX += 6 * textDotPitch
+	}
+
+	if len(vertices) == 0 {
+		return
+	}
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, a.app.ParticleVBO)
+	gl.BufferData(gl.ARRAY_BUFFER, len(vertices)*4, gl.Ptr(vertices), gl.DYNAMIC_DRAW)
+
+	width, height := window.GetSize()
+
+	gl.UseProgram(a.app.ParticleProgram)
+	resolutionLoc := gl.GetUniformLocation(a.app.ParticleProgram, gl.Str("resolution\x00"))
+	gl.Uniform2f(resolutionLoc, float32(width), float32(height))
+
+	gl.BindVertexArray(a.app.ParticleVAO)
+	gl.DrawArrays(gl.POINTS, 0, int32(len(vertices)/6))
+	gl.BindVertexArray(0)
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-3]) + "..."
+}
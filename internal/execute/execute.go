@@ -2,14 +2,18 @@ package execute
 
 import (
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"syscall"
-	"time"
 
+	"github.com/ThatOtherAndrew/Hexecute/internal/adapt"
 	"github.com/ThatOtherAndrew/Hexecute/internal/models"
 	"github.com/ThatOtherAndrew/Hexecute/internal/spawn"
+	"github.com/ThatOtherAndrew/Hexecute/internal/state"
 	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
-	"github.com/ThatOtherAndrew/Hexecute/pkg/wayland"
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
 )
 
 type App struct {
@@ -20,12 +24,40 @@ func New(app *models.App) *App {
 	return &App{app: app}
 }
 
-func Command(command string) error {
-	if command == "" {
-		return nil
+// MinScore is the score a gesture must exceed to be executed, unless the
+// gesture overrides it with its own min_score.
+const MinScore = 0.6
+
+// Threshold returns the score a gesture must exceed to be executed.
+func Threshold(gesture *models.GestureConfig) float64 {
+	if gesture.MinScore > 0 {
+		return gesture.MinScore
+	}
+	return MinScore
+}
+
+// ActionFor returns what a gesture runs: its Action, or its Command run by a
+// shell for gestures that don't have one.
+func ActionFor(gesture *models.GestureConfig) models.Action {
+	if gesture.Action != nil {
+		return *gesture.Action
+	}
+	return models.Action{Shell: gesture.Command}
+}
+
+// Run starts an action in its own session, without waiting for it to exit.
+func Run(action models.Action) error {
+	if err := action.Validate(); err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if len(action.Exec) > 0 {
+		cmd = exec.Command(action.Exec[0], action.Exec[1:]...)
+	} else {
+		cmd = exec.Command("sh", "-c", action.Shell)
 	}
 
-	cmd := exec.Command("sh", "-c", command)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setsid: true,
 	}
@@ -33,46 +65,173 @@ func Command(command string) error {
 	cmd.Stdout = nil
 	cmd.Stderr = nil
 
+	if action.Cwd != "" {
+		dir, err := expandHome(action.Cwd)
+		if err != nil {
+			return err
+		}
+		cmd.Dir = dir
+	}
+
+	if len(action.Env) > 0 {
+		cmd.Env = os.Environ()
+		for key, value := range action.Env {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+
 	return cmd.Start()
 }
 
-func (a *App) RecognizeAndExecute(window *wayland.WaylandWindow, x, y float32) {
-	if len(a.app.Points) < 5 {
-		log.Println("Gesture too short, ignoring")
-		return
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
 	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, path[1:]), nil
+}
 
-	processed := stroke.ProcessStroke(a.app.Points)
+const (
+	OutcomeNone      = "none"
+	OutcomeMatched   = "matched"
+	OutcomeAmbiguous = "ambiguous"
+	OutcomeRejected  = "rejected"
+)
 
-	bestMatch := -1
-	bestScore := 0.0
+// Result is the outcome of recognising a drawn gesture. Best and Second index
+// the saved gestures, or are -1 when there is no such gesture.
+type Result struct {
+	Matches []stroke.Match
+	Best    int
+	Second  int
+	Outcome string
+}
 
-	for i, gesture := range a.app.SavedGestures {
-		match, score := stroke.UnistrokeRecognise(processed, gesture.Templates)
-		log.Printf("Gesture %d (%s): template %d, score %.3f", i, gesture.Command, match, score)
+// Score returns the score of the gesture at index, or 0 for -1.
+func (r Result) Score(index int) float64 {
+	if index < 0 {
+		return 0
+	}
+	return r.Matches[index].Score
+}
+
+// Recognize scores a drawn gesture against the saved gestures and decides
+// whether one of them should be executed. Disabled gestures are scored but
+// never chosen.
+func Recognize(saved []models.GestureConfig, points []models.Point, starts []int, margin float64) Result {
+	result := Result{
+		Matches: stroke.ScoreAll(points, starts, saved),
+		Best:    -1,
+		Second:  -1,
+	}
 
-		if score > bestScore {
-			bestScore = score
-			bestMatch = i
+	bestScore := 0.0
+	secondScore := 0.0
+	for _, m := range result.Matches {
+		if !saved[m.Gesture].IsEnabled() {
+			continue
+		}
+		if m.Score > bestScore {
+			secondScore, result.Second = bestScore, result.Best
+			bestScore, result.Best = m.Score, m.Gesture
+		} else if m.Score > secondScore {
+			secondScore, result.Second = m.Score, m.Gesture
 		}
 	}
 
-	if bestMatch >= 0 && bestScore > 0.6 {
-		command := a.app.SavedGestures[bestMatch].Command
-		log.Printf("Matched gesture: %s (score: %.3f)", command, bestScore)
+	switch {
+	case result.Best < 0 || bestScore <= Threshold(&saved[result.Best]):
+		result.Outcome = OutcomeNone
+	case saved[result.Best].Reject:
+		result.Outcome = OutcomeRejected
+	case result.Second >= 0 && bestScore-secondScore < margin:
+		result.Outcome = OutcomeAmbiguous
+	default:
+		result.Outcome = OutcomeMatched
+	}
+	return result
+}
+
+func (a *App) RecognizeAndExecute(
+	window window.Window,
+	strokes [][]models.Point,
+	x, y float32,
+) {
+	points, starts := stroke.JoinStrokes(strokes)
+	if len(points) < 5 {
+		log.Println("Gesture too short, ignoring")
+		state.New(a.app).Rest()
+		return
+	}
 
-		if err := Command(command); err != nil {
-			log.Printf("Failed to execute command: %v", err)
-		} else {
-			log.Printf("Executed: %s", command)
+	margin := float64(a.app.Settings.AmbiguityMargin)
+	result := Recognize(a.app.SavedGestures, points, starts, margin)
+	for _, m := range result.Matches {
+		gesture := &a.app.SavedGestures[m.Gesture]
+		if !gesture.IsEnabled() {
+			log.Printf("Gesture %d (%s): disabled, score %.3f", m.Gesture, gesture.Label(), m.Score)
+			continue
 		}
+		log.Printf("Gesture %d (%s): template %d, score %.3f",
+			m.Gesture, gesture.Label(), m.Template, m.Score)
+	}
 
-		a.app.IsExiting = true
-		a.app.ExitStartTime = time.Now()
-		window.DisableInput()
+	bestScore := result.Score(result.Best)
+	switch result.Outcome {
+	case OutcomeRejected:
+		log.Printf("Matched rejection sample (score: %.3f), ignoring", bestScore)
+		a.noMatch(window, x, y)
+	case OutcomeAmbiguous:
+		log.Printf("Ambiguous match: %s (score: %.3f) vs %s (score: %.3f)",
+			a.app.SavedGestures[result.Best].Label(), bestScore,
+			a.app.SavedGestures[result.Second].Label(), result.Score(result.Second))
 		spawn := spawn.New(a.app)
-		spawn.SpawnExitWisps(x, y)
-	} else {
+		spawn.SpawnAmbiguousSparks(x, y)
+		a.noMatch(window, x, y)
+	case OutcomeMatched:
+		gesture := &a.app.SavedGestures[result.Best]
+		log.Printf("Matched gesture: %s (score: %.3f)", gesture.Label(), bestScore)
+		a.app.MatchedCommand = gesture.Command
+
+		// With PrintMatch, the caller decides what to do with the match, so
+		// it is neither run nor learned from.
+		if !a.app.PrintMatch {
+			if err := Run(ActionFor(gesture)); err != nil {
+				log.Printf("Failed to execute command: %v", err)
+			} else {
+				log.Printf("Executed: %s", gesture.Command)
+			}
+
+			if a.app.Settings.Adaptive {
+				if err := adapt.Record(*gesture, points, starts, a.app.Settings.MaxTemplates); err != nil {
+					log.Printf("Failed to record gesture for adaptation: %v", err)
+				}
+			}
+		}
+
+		a.exit(window, x, y)
+	default:
 		log.Printf("No confident match (best score: %.3f)", bestScore)
+		a.noMatch(window, x, y)
 	}
 }
+
+// noMatch waits for another gesture, except with PrintMatch, where the caller
+// is told nothing matched by exiting without a match.
+func (a *App) noMatch(window window.Window, x, y float32) {
+	if a.app.PrintMatch {
+		a.exit(window, x, y)
+		return
+	}
+	state.New(a.app).Rest()
+}
+
+func (a *App) exit(window window.Window, x, y float32) {
+	state.New(a.app).To(models.StateExiting)
+	window.DisableInput()
+	spawn := spawn.New(a.app)
+	spawn.SpawnExitWisps(x, y)
+}
@@ -2,13 +2,17 @@ package gestures
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"math"
 	"math/rand/v2"
-	"os"
+	"slices"
 	"time"
 
 	"github.com/ThatOtherAndrew/Hexecute/internal/config"
 	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
 )
 
 type App struct {
@@ -19,68 +23,285 @@ func New(app *models.App) *App {
 	return &App{app: app}
 }
 
+// LoadGestures reads the saved gestures, upgrading the gestures file in place
+// if it is from an older version.
 func LoadGestures() ([]models.GestureConfig, error) {
 	configFile, err := config.GetPath()
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(configFile)
+	gestures, version, err := load(configFile)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []models.GestureConfig{}, nil
-		}
 		return nil, err
 	}
-
-	var gestures []models.GestureConfig
-	if err := json.Unmarshal(data, &gestures); err != nil {
-		return nil, err
+	if version < Version {
+		if err := upgrade(configFile); err != nil {
+			log.Printf("Failed to upgrade gestures file: %v", err)
+		}
 	}
 
 	return gestures, nil
 }
 
-func SaveGesture(command string, templates [][]models.Point) error {
+// Find returns the index of the gesture named key, or failing that of the
+// gesture whose command is key, or -1 if there is neither.
+func Find(gestures []models.GestureConfig, key string) int {
+	if i := slices.IndexFunc(gestures, func(g models.GestureConfig) bool {
+		return !g.Reject && g.Name == key
+	}); i >= 0 {
+		return i
+	}
+	return slices.IndexFunc(gestures, func(g models.GestureConfig) bool {
+		return !g.Reject && g.Command == key
+	})
+}
+
+// Validate checks a set of gestures before it is saved. Names and commands
+// must be unique, so that every gesture can be found by either.
+func Validate(gestures []models.GestureConfig) error {
+	commands := map[string]bool{}
+	names := map[string]bool{}
+	hasReject := false
+	for _, g := range gestures {
+		for _, template := range g.Templates {
+			if !stroke.IsFinite(template) {
+				return fmt.Errorf("gesture for %q has a template with non-finite coordinates", g.Label())
+			}
+		}
+
+		if g.Reject {
+			if hasReject {
+				return errors.New("more than one set of rejection samples")
+			}
+			hasReject = true
+			continue
+		}
+
+		if g.Command == "" {
+			return errors.New("gesture has no command")
+		}
+		if commands[g.Command] {
+			return fmt.Errorf("more than one gesture for command %q", g.Command)
+		}
+		commands[g.Command] = true
+		if g.Name != "" {
+			if names[g.Name] {
+				return fmt.Errorf("more than one gesture named %q", g.Name)
+			}
+			names[g.Name] = true
+		}
+		if g.Action != nil {
+			if err := g.Action.Validate(); err != nil {
+				return fmt.Errorf("gesture %q: %w", g.Label(), err)
+			}
+		}
+	}
+
+	for name := range names {
+		if commands[name] {
+			return fmt.Errorf("gesture name %q is also the command of another gesture", name)
+		}
+	}
+	return nil
+}
+
+// SaveGestures validates and saves the whole set of gestures, replacing the
+// gestures file.
+func SaveGestures(gestures []models.GestureConfig) error {
+	return modify(func([]models.GestureConfig) ([]models.GestureConfig, error) {
+		return gestures, nil
+	})
+}
+
+// UpdateOrAdd applies change to the saved gesture for command, or to the
+// rejection samples with reject set, as read while the gestures file is
+// locked, so that changes saved since it was loaded are kept. If there is
+// none, change is applied to an empty gesture that is then added, with found
+// false.
+func UpdateOrAdd(
+	command string,
+	reject bool,
+	change func(gesture *models.GestureConfig, found bool) error,
+) error {
+	return modify(func(gestures []models.GestureConfig) ([]models.GestureConfig, error) {
+		index := slices.IndexFunc(gestures, func(g models.GestureConfig) bool {
+			return g.Command == command && g.Reject == reject
+		})
+		if index >= 0 {
+			return gestures, change(&gestures[index], true)
+		}
+		var gesture models.GestureConfig
+		if err := change(&gesture, false); err != nil {
+			return nil, err
+		}
+		return append(gestures, gesture), nil
+	})
+}
+
+// Update applies change to the gesture found by key, as with Find, and saves
+// the result unless change returns an error.
+func Update(key string, change func(gesture *models.GestureConfig) error) error {
+	return modify(func(gestures []models.GestureConfig) ([]models.GestureConfig, error) {
+		index := Find(gestures, key)
+		if index < 0 {
+			return nil, fmt.Errorf("gesture not found: %s", key)
+		}
+		return gestures, change(&gestures[index])
+	})
+}
+
+// Remove deletes the gesture found by key, as with Find.
+func Remove(key string) error {
+	return modify(func(gestures []models.GestureConfig) ([]models.GestureConfig, error) {
+		index := Find(gestures, key)
+		if index < 0 {
+			return nil, fmt.Errorf("gesture not found: %s", key)
+		}
+		return slices.Delete(gestures, index, index+1), nil
+	})
+}
+
+// Duplicate saves a copy of the gesture found by key, with the same shape and
+// matching options, for another command. The copy has no action, and is only
+// named if name is set.
+func Duplicate(key, command, name string) error {
+	return modify(func(gestures []models.GestureConfig) ([]models.GestureConfig, error) {
+		index := Find(gestures, key)
+		if index < 0 {
+			return nil, fmt.Errorf("gesture not found: %s", key)
+		}
+		duplicate := gestures[index]
+		duplicate.Command = command
+		duplicate.Name = name
+		duplicate.Action = nil
+		duplicate.Templates = slices.Clone(duplicate.Templates)
+		duplicate.Strokes = slices.Clone(duplicate.Strokes)
+		duplicate.Tags = slices.Clone(duplicate.Tags)
+		return append(gestures, duplicate), nil
+	})
+}
+
+// Restore replaces the gestures with backup n, counting from 1 for the most
+// recent. The current gestures file is backed up in turn, even if it can't be
+// read.
+func Restore(n int) error {
 	configFile, err := config.GetPath()
 	if err != nil {
 		return err
 	}
 
-	var gestures []models.GestureConfig
-	if data, err := os.ReadFile(configFile); err == nil {
-		if err := json.Unmarshal(data, &gestures); err != nil {
-			return err
-		}
+	unlock, err := config.Lock(configFile)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	newGesture := models.GestureConfig{
-		Command:   command,
-		Templates: templates,
+	data, err := config.ReadBackup(configFile, n)
+	if err != nil {
+		return err
 	}
+	gestures, _, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("backup %d is not valid: %w", n, err)
+	}
+	return write(configFile, gestures)
+}
 
-	found := false
-	for i, g := range gestures {
-		if g.Command == command {
-			gestures[i] = newGesture
-			found = true
-			break
-		}
+// modify loads the gestures, applies change and saves the result. The
+// gestures file is locked throughout, so that concurrent writers don't lose
+// each other's changes.
+func modify(change func(gestures []models.GestureConfig) ([]models.GestureConfig, error)) error {
+	configFile, err := config.GetPath()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := config.Lock(configFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	gestures, _, err := load(configFile)
+	if err != nil {
+		return err
 	}
-	if !found {
-		gestures = append(gestures, newGesture)
+	gestures, err = change(gestures)
+	if err != nil {
+		return err
+	}
+	return write(configFile, gestures)
+}
+
+// write validates and atomically saves the gestures, keeping the previous
+// version as a backup. The caller must hold the lock on the gestures file.
+func write(configFile string, gestures []models.GestureConfig) error {
+	if err := Validate(gestures); err != nil {
+		return err
 	}
 
-	data, err := json.Marshal(gestures)
+	data, err := json.Marshal(File{Version: Version, Gestures: gestures})
 	if err != nil {
 		return err
 	}
+	if err := config.Backup(configFile, data); err != nil {
+		return err
+	}
+	return config.WriteFile(configFile, data)
+}
+
+// PruneTemplates drops the least representative templates of a gesture until
+// it has at most limit of them, returning how many were removed. A template's
+// representativeness is its mean score against the gesture's other templates.
+func PruneTemplates(gesture *models.GestureConfig, limit int) int {
+	removed := 0
+	for len(gesture.Templates) > limit && len(gesture.Templates) > 1 {
+		recognizer := stroke.ForGesture(gesture)
+		hasStrokes := len(gesture.Strokes) == len(gesture.Templates)
 
-	return os.WriteFile(configFile, data, 0644)
+		worst := -1
+		worstScore := math.Inf(1)
+		for i, template := range gesture.Templates {
+			var starts []int
+			if hasStrokes {
+				starts = gesture.Strokes[i]
+			}
+			candidate := recognizer.PreprocessCandidate(template, starts)
+
+			total := 0.0
+			for j := range gesture.Templates {
+				if j == i {
+					continue
+				}
+				other := *gesture
+				other.Templates = gesture.Templates[j : j+1]
+				other.Strokes = nil
+				if hasStrokes {
+					other.Strokes = gesture.Strokes[j : j+1]
+				}
+				other.Vectors = nil
+				_, score := recognizer.Score(candidate, &other)
+				total += score
+			}
+			if mean := total / float64(len(gesture.Templates)-1); mean < worstScore {
+				worstScore = mean
+				worst = i
+			}
+		}
+
+		gesture.Templates = slices.Delete(gesture.Templates, worst, worst+1)
+		if hasStrokes {
+			gesture.Strokes = slices.Delete(gesture.Strokes, worst, worst+1)
+		}
+		gesture.Vectors = nil
+		removed++
+	}
+	return removed
 }
 
 func (a *App) AddPoint(x, y float32) {
-	newPoint := models.Point{X: x, Y: y, BornTime: time.Now()}
+	newPoint := models.Point{X: x, Y: y, BornTime: a.app.Now}
 
 	shouldAdd := false
 	if len(a.app.Points) == 0 {
@@ -113,8 +334,17 @@ func (a *App) AddPoint(x, y float32) {
 
 	if shouldAdd {
 		a.app.Points = append(a.app.Points, newPoint)
+		a.app.PointsSincePreview++
 		if len(a.app.Points) > MAX_POINTS {
 			a.app.Points = a.app.Points[len(a.app.Points)-MAX_POINTS:]
 		}
 	}
+
+	// Points are forgotten once they have faded from the trail, here rather
+	// than when the trail is drawn, so recognition doesn't depend on
+	// rendering.
+	cutoff := a.app.Now.Add(-1500 * time.Millisecond)
+	for len(a.app.Points) > 0 && a.app.Points[0].BornTime.Before(cutoff) {
+		a.app.Points = a.app.Points[1:]
+	}
 }
@@ -0,0 +1,140 @@
+package gestures
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+)
+
+// Version is the format of the gestures file written by this build. Version
+// 1 files are a bare array of gestures, from before the format was versioned.
+const Version = 2
+
+// File is the gestures file.
+type File struct {
+	Version  int                    `json:"version"`
+	Gestures []models.GestureConfig `json:"gestures"`
+}
+
+// migrations upgrade a gestures file by one version each: migrations[i]
+// turns version i+1 into version i+2. Every change to the format adds one.
+var migrations = []func(data []byte) ([]byte, error){
+	migrateV1,
+}
+
+// migrateV1 wraps a bare array of gestures in a versioned object.
+func migrateV1(data []byte) ([]byte, error) {
+	var gestures json.RawMessage
+	if err := json.Unmarshal(data, &gestures); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{"version": 2, "gestures": gestures})
+}
+
+// fileVersion reads the version of a gestures file without decoding the
+// gestures in it.
+func fileVersion(data []byte) (int, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return 1, nil
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	if header.Version < 1 {
+		return 0, errors.New("missing version")
+	}
+	return header.Version, nil
+}
+
+// decode reads a gestures file of any supported version, upgrading it to the
+// current one, and returns the version it was in.
+func decode(data []byte) ([]models.GestureConfig, int, error) {
+	version, err := fileVersion(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > Version {
+		return nil, version, fmt.Errorf(
+			"gestures file is version %d, but this version of Hexecute only supports up to version %d; please upgrade Hexecute",
+			version, Version)
+	}
+
+	for v := version; v < Version; v++ {
+		if data, err = migrations[v-1](data); err != nil {
+			return nil, version, fmt.Errorf("failed to migrate gestures from version %d: %w", v, err)
+		}
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, version, err
+	}
+	if file.Gestures == nil {
+		file.Gestures = []models.GestureConfig{}
+	}
+	return file.Gestures, version, nil
+}
+
+// load reads the gestures file at path, returning the version it is in.
+func load(configFile string) ([]models.GestureConfig, int, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.GestureConfig{}, Version, nil
+		}
+		return nil, 0, err
+	}
+
+	gestures, version, err := decode(data)
+	if err != nil {
+		if version > Version {
+			return nil, version, err
+		}
+		return nil, version, fmt.Errorf("%s is not valid, 'hexecute restore' can recover a backup: %w", configFile, err)
+	}
+	return gestures, version, nil
+}
+
+// upgrade rewrites a gestures file from an older version in the current
+// format, keeping the original as gestures.json.v<version>.
+func upgrade(configFile string) error {
+	unlock, err := config.Lock(configFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Another instance may have upgraded it while waiting for the lock.
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	gestures, version, err := decode(data)
+	if err != nil || version == Version {
+		return err
+	}
+
+	backupFile := fmt.Sprintf("%s.v%d", configFile, version)
+	if _, err := os.Stat(backupFile); os.IsNotExist(err) {
+		if err := config.WriteFile(backupFile, data); err != nil {
+			return err
+		}
+	}
+	if err := write(configFile, gestures); err != nil {
+		return err
+	}
+
+	log.Printf("Upgraded %s from version %d to %d, the original is kept as %s",
+		configFile, version, Version, backupFile)
+	return nil
+}
@@ -0,0 +1,321 @@
+package learn
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/execute"
+	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/spawn"
+	"github.com/ThatOtherAndrew/Hexecute/internal/state"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
+)
+
+// minConsistency is the score a new sample must reach against the samples
+// captured before it, so that one stray drawing doesn't spoil the gesture.
+const minConsistency = 0.5
+
+type App struct {
+	app *models.App
+}
+
+func New(app *models.App) *App {
+	return &App{app: app}
+}
+
+// Options describe the gesture to learn. With Reject set, rejection samples
+// are learned instead of a gesture for Command. Action, when set, is run in
+// place of Command, and Name is shown in place of it.
+type Options struct {
+	Command          string         `json:"command,omitempty"`
+	Name             string         `json:"name,omitempty"`
+	Action           *models.Action `json:"action,omitempty"`
+	Reject           bool           `json:"reject,omitempty"`
+	Samples          int            `json:"samples"`
+	Append           bool           `json:"append,omitempty"`
+	Rotation         string         `json:"rotation,omitempty"`
+	StartDirection   bool           `json:"start_direction,omitempty"`
+	EnforceDirection bool           `json:"enforce_direction,omitempty"`
+}
+
+// Start moves an idle app into learn mode. Rejection samples are always added
+// to the existing ones, as they are learned a few at a time.
+func (a *App) Start(options Options) error {
+	if options.Action != nil && options.Reject {
+		return fmt.Errorf("rejection samples cannot have an action")
+	}
+	if !state.New(a.app).Is(models.StateIdle) {
+		return fmt.Errorf("cannot start learning while %s", a.app.State)
+	}
+
+	session := &models.LearnSession{
+		Name:    options.Name,
+		Action:  options.Action,
+		Samples: options.Samples,
+		Gesture: models.GestureConfig{
+			Command:          options.Command,
+			Name:             options.Name,
+			Action:           options.Action,
+			Reject:           options.Reject,
+			Rotation:         options.Rotation,
+			StartDirection:   options.StartDirection,
+			EnforceDirection: options.EnforceDirection,
+		},
+	}
+
+	index := slices.IndexFunc(a.app.SavedGestures, func(g models.GestureConfig) bool {
+		return g.Command == options.Command && g.Reject == options.Reject
+	})
+	if options.Reject && index >= 0 {
+		session.Append = true
+		session.Gesture = a.app.SavedGestures[index]
+		log.Printf("Adding to %d existing rejection template(s)", len(session.Gesture.Templates))
+	} else if options.Append {
+		if index < 0 {
+			return fmt.Errorf("gesture not found: %s", options.Command)
+		}
+		session.Append = true
+		session.Gesture = a.app.SavedGestures[index]
+		if options.Action != nil {
+			session.Gesture.Action = options.Action
+		}
+		if options.Name != "" {
+			session.Gesture.Name = options.Name
+		}
+		log.Printf("Adding to %d existing template(s)", len(session.Gesture.Templates))
+	} else if index >= 0 {
+		// Relearning a gesture replaces its shape, but keeps what it was
+		// labelled with, what it runs and how strictly it is matched.
+		existing := a.app.SavedGestures[index]
+		if options.Name == "" {
+			session.Gesture.Name = existing.Name
+		}
+		if options.Action == nil {
+			session.Gesture.Action = existing.Action
+		}
+		session.Gesture.MinScore = existing.MinScore
+		session.Gesture.Description = existing.Description
+		session.Gesture.Tags = existing.Tags
+		session.Gesture.Enabled = existing.Enabled
+	}
+
+	// Check the gesture can be saved before it is drawn, rather than after.
+	learned := slices.Clone(a.app.SavedGestures)
+	if index >= 0 {
+		learned[index] = session.Gesture
+	} else {
+		learned = append(learned, session.Gesture)
+	}
+	if err := gestures.Validate(learned); err != nil {
+		return err
+	}
+
+	if !state.New(a.app).Learn(session) {
+		return fmt.Errorf("cannot start learning while %s", a.app.State)
+	}
+
+	if options.Reject {
+		log.Printf("Learn mode: Draw %d stroke(s) that should never run a command", options.Samples)
+	} else {
+		log.Printf("Learn mode: Draw the gesture %d times for command '%s'", options.Samples, options.Command)
+	}
+	return nil
+}
+
+// AddSample preprocesses a drawn sample and adds it to the gesture being
+// learned, saving the gesture once enough samples have been captured.
+func (a *App) AddSample(window window.Window, strokes [][]models.Point, x, y float32) {
+	points, starts := stroke.JoinStrokes(strokes)
+	if len(points) < 5 {
+		a.reject("Gesture too short")
+		return
+	}
+
+	recognizer := a.recognizer()
+	template, templateStarts := recognizer.PreprocessTemplate(points, starts)
+	if !stroke.IsFinite(template) {
+		a.reject("Gesture has invalid coordinates")
+		return
+	}
+
+	// Rejection samples are unrelated scribbles, so they aren't expected to
+	// look like each other.
+	session := a.app.Learn
+	earlierTemplates, earlierStrokes := a.templates()
+	if len(earlierTemplates) > 0 && !session.Gesture.Reject {
+		earlier := session.Gesture
+		earlier.Templates = earlierTemplates
+		earlier.Strokes = earlierStrokes
+		earlier.Vectors = nil
+		candidate := recognizer.PreprocessCandidate(points, starts)
+		if _, score := recognizer.Score(candidate, &earlier); score < minConsistency {
+			a.reject("Gesture doesn't match the earlier samples")
+			return
+		}
+	}
+
+	session.Drawn = append(session.Drawn, template)
+	if templateStarts != nil {
+		session.Strokes = append(session.Strokes, templateStarts)
+	}
+	session.Hint = ""
+	log.Printf("Captured gesture %d/%d", session.Count(), session.Samples)
+
+	if session.Count() < session.Samples {
+		state.New(a.app).Rest()
+		return
+	}
+
+	if session.Gesture.Reject {
+		a.save(window, x, y)
+		return
+	}
+
+	if command, score, found := a.findConflict(); found {
+		log.Printf("Gesture conflicts with existing gesture: %s (score: %.3f)", command, score)
+		log.Println("Press Enter to save anyway, R to redraw, or Esc to cancel")
+		session.Conflict = command
+		state.New(a.app).To(models.StateConfirming)
+		return
+	}
+
+	a.save(window, x, y)
+}
+
+// Confirm saves a gesture that conflicts with an existing one.
+func (a *App) Confirm(window window.Window, x, y float32) {
+	if !state.New(a.app).Is(models.StateConfirming) {
+		return
+	}
+	log.Println("Saving conflicting gesture")
+	a.app.Learn.Conflict = ""
+	a.save(window, x, y)
+}
+
+// Redraw discards the captured samples so the gesture can be drawn again.
+func (a *App) Redraw() {
+	log.Println("Discarding samples, draw the gesture again")
+	session := a.app.Learn
+	session.Conflict = ""
+	session.Drawn = nil
+	session.Strokes = nil
+	session.Hint = ""
+	state.New(a.app).To(models.StateLearning)
+}
+
+// findConflict scores the captured samples against every saved gesture for a
+// different command, as recognition would, returning the first one they
+// would be mistaken for.
+func (a *App) findConflict() (command string, score float64, found bool) {
+	session := a.app.Learn
+	for j, template := range session.Drawn {
+		var starts []int
+		if j < len(session.Strokes) {
+			starts = session.Strokes[j]
+		}
+
+		for _, m := range stroke.ScoreAll(template, starts, a.app.SavedGestures) {
+			saved := &a.app.SavedGestures[m.Gesture]
+			if saved.Command == session.Gesture.Command || !saved.IsEnabled() {
+				continue
+			}
+			if m.Score > execute.Threshold(saved) {
+				if saved.Reject {
+					return "rejection samples", m.Score, true
+				}
+				return saved.Label(), m.Score, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// recognizer returns the Recognizer for new samples: the one the existing
+// gesture was learned with when appending, or the configured one otherwise.
+func (a *App) recognizer() stroke.Recognizer {
+	if a.app.Learn.Append {
+		return stroke.ForGesture(&a.app.Learn.Gesture)
+	}
+	return stroke.ForSettings(a.app.Settings)
+}
+
+// templates returns the samples captured so far, after the existing
+// gesture's templates when appending.
+func (a *App) templates() ([][]models.Point, [][]int) {
+	session := a.app.Learn
+	templates := append(slices.Clone(session.Gesture.Templates), session.Drawn...)
+	strokes := append(slices.Clone(session.Gesture.Strokes), session.Strokes...)
+	return templates, strokes
+}
+
+// save adds the captured samples to the gesture as it is saved now, rather
+// than as it was when learning started, so that changes made to it since,
+// such as by another learner or by 'hexecute edit', are kept.
+func (a *App) save(window window.Window, x, y float32) {
+	session := a.app.Learn
+	recognizer := a.recognizer()
+	var gesture models.GestureConfig
+	err := gestures.UpdateOrAdd(session.Gesture.Command, session.Gesture.Reject,
+		func(saved *models.GestureConfig, found bool) error {
+			switch {
+			case !found && session.Append && !session.Gesture.Reject:
+				return fmt.Errorf("gesture was removed while learning: %s", session.Gesture.Label())
+			case !found:
+				*saved = session.Gesture
+				saved.Templates, saved.Strokes = nil, nil
+			case !session.Append:
+				// Relearning replaces the shape and how it is matched.
+				saved.Templates, saved.Strokes = nil, nil
+				saved.Rotation = session.Gesture.Rotation
+				saved.StartDirection = session.Gesture.StartDirection
+				saved.EnforceDirection = session.Gesture.EnforceDirection
+			case saved.Recognizer != session.Gesture.Recognizer:
+				return fmt.Errorf("gesture was relearned while learning: %s", saved.Label())
+			}
+			if session.Name != "" {
+				saved.Name = session.Name
+			}
+			if session.Action != nil {
+				saved.Action = session.Action
+			}
+
+			saved.Templates = append(saved.Templates, session.Drawn...)
+			saved.Strokes = append(saved.Strokes, session.Strokes...)
+			saved.Vectors = nil
+			saved.Prefixes = nil
+			if removed := gestures.PruneTemplates(saved, a.app.Settings.MaxTemplates); removed > 0 {
+				log.Printf("Pruned %d least representative template(s)", removed)
+			}
+			direction := stroke.CommonDirection(saved.Templates)
+			saved.Recognizer = recognizer.Name()
+			saved.Direction = &direction
+			gesture = *saved
+			return nil
+		})
+	// The app may be the daemon, so a gesture that can't be saved ends the
+	// session rather than the process.
+	if err != nil {
+		log.Printf("Failed to save gesture: %v", err)
+		session.Err = err
+	} else if gesture.Reject {
+		log.Printf("Rejection samples saved (%d template(s))", len(gesture.Templates))
+	} else {
+		log.Printf("Gesture saved for command: %s (%s)",
+			gesture.Label(), stroke.DescribeDirection(*gesture.Direction))
+	}
+
+	state.New(a.app).To(models.StateExiting)
+	window.DisableInput()
+	spawn := spawn.New(a.app)
+	spawn.SpawnExitWisps(x, y)
+}
+
+func (a *App) reject(reason string) {
+	log.Printf("%s, please draw it again", reason)
+	a.app.Learn.Hint = "Try again"
+	a.app.Learn.HintTime = a.app.Now
+	state.New(a.app).Rest()
+}
@@ -0,0 +1,182 @@
+package loop
+
+import (
+	"log"
+	"time"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/draw"
+	"github.com/ThatOtherAndrew/Hexecute/internal/execute"
+	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/learn"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/preview"
+	"github.com/ThatOtherAndrew/Hexecute/internal/spawn"
+	"github.com/ThatOtherAndrew/Hexecute/internal/state"
+	"github.com/ThatOtherAndrew/Hexecute/internal/update"
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
+)
+
+// exitDuration is how long, in seconds, the exit animation plays before the
+// loop ends.
+const exitDuration = 0.8
+
+type App struct {
+	app        *models.App
+	wasPressed bool
+	// Render draws each frame with OpenGL. Without it, the loop only
+	// processes input, so it can run without a GL context.
+	Render bool
+}
+
+func New(app *models.App) *App {
+	state.New(app).OnTransition(func(from, to string) {
+		if to == models.StateExiting {
+			app.Points = nil
+			app.Strokes = nil
+			preview.New(app).Clear()
+		}
+	})
+	return &App{app: app, Render: true}
+}
+
+// clock is implemented by windows that decide how long each frame takes, such
+// as replays, instead of the loop measuring it.
+type clock interface {
+	// FrameDelta returns the dt, in seconds, of the frame the next call to
+	// PollEvents reads.
+	FrameDelta() float32
+}
+
+// Run steps the loop once per frame until the window closes or the exit
+// animation has finished.
+func (a *App) Run(w window.Window) {
+	x, y := w.GetCursorPos()
+	a.app.LastCursorX = float32(x)
+	a.app.LastCursorY = float32(y)
+
+	a.app.Now = time.Now()
+	lastTime := a.app.Now
+	clock, hasClock := w.(clock)
+	for !w.ShouldClose() {
+		var dt float32
+		if hasClock {
+			dt = clock.FrameDelta()
+		} else {
+			now := time.Now()
+			dt = float32(now.Sub(lastTime).Seconds())
+			lastTime = now
+		}
+
+		if !a.Step(w, dt) {
+			break
+		}
+	}
+}
+
+// Step advances app.Now by dt, polls the window, handles its input and draws a
+// frame. All timing in the loop follows app.Now rather than the wall clock, so
+// replays keep the timing they were recorded with. It returns false once the
+// loop should end.
+func (a *App) Step(w window.Window, dt float32) bool {
+	app := a.app
+	state := state.New(app)
+	app.Now = app.Now.Add(time.Duration(float64(dt) * float64(time.Second)))
+
+	w.PollEvents()
+	update := update.New(app)
+	update.UpdateCursor(w)
+
+	if key, keyState, hasKey := w.GetLastKey(); hasKey {
+		if keyState == 1 && state.Is(models.StateConfirming) {
+			learn := learn.New(app)
+			switch key {
+			case window.KeyReturn, window.KeyKPEnter:
+				x, y := w.GetCursorPos()
+				learn.Confirm(w, float32(x), float32(y))
+			case window.KeyLowerR, window.KeyCapitalR:
+				learn.Redraw()
+			}
+		}
+		if keyState == 1 && key == window.KeyEscape && !state.Is(models.StateExiting) {
+			if state.Is(models.StateDrawing, models.StateRecognizing) {
+				log.Println("Esc key pressed, aborting gesture")
+			} else {
+				log.Println("Esc key pressed, exiting")
+			}
+			state.To(models.StateExiting)
+			w.DisableInput()
+			x, y := w.GetCursorPos()
+			spawn := spawn.New(app)
+			spawn.SpawnExitWisps(float32(x), float32(y))
+		}
+		w.ClearLastKey()
+	}
+
+	if state.Is(models.StateExiting) && state.Since().Seconds() > exitDuration {
+		return false
+	}
+
+	isPressed := w.GetMouseButton()
+	if isPressed && !a.wasPressed &&
+		state.Is(models.StateIdle, models.StateLearning, models.StateRecognizing) {
+		if len(app.Strokes) == 0 {
+			log.Println("Gesture started")
+		} else {
+			log.Println("Stroke started")
+		}
+		state.To(models.StateDrawing)
+	} else if !isPressed && a.wasPressed && state.Is(models.StateDrawing) {
+		if len(app.Points) > 0 {
+			app.Strokes = append(app.Strokes, app.Points)
+			app.LastStrokeTime = app.Now
+			app.Points = nil
+		}
+		if len(app.Strokes) > 0 {
+			state.To(models.StateRecognizing)
+		} else {
+			state.Rest()
+		}
+	}
+	a.wasPressed = isPressed
+
+	var strokeTimeout float64
+	if app.Settings.Multistroke {
+		strokeTimeout = float64(app.Settings.StrokeTimeout)
+	}
+	if state.Is(models.StateRecognizing) &&
+		app.Now.Sub(app.LastStrokeTime).Seconds() >= strokeTimeout {
+		strokes := app.Strokes
+		app.Strokes = nil
+		preview.New(app).Clear()
+
+		log.Println("Gesture completed")
+		x, y := w.GetCursorPos()
+		if app.Learn != nil {
+			learn := learn.New(app)
+			learn.AddSample(w, strokes, float32(x), float32(y))
+		} else {
+			exec := execute.New(app)
+			exec.RecognizeAndExecute(w, strokes, float32(x), float32(y))
+		}
+	}
+
+	if state.Is(models.StateDrawing) {
+		x, y := w.GetCursorPos()
+		gesture := gestures.New(app)
+		gesture.AddPoint(float32(x), float32(y))
+
+		spawn := spawn.New(app)
+		spawn.SpawnCursorSparkles(float32(x), float32(y))
+
+		preview := preview.New(app)
+		preview.Update()
+	}
+
+	update.UpdateParticles(dt)
+	if a.Render {
+		drawer := draw.New(app)
+		drawer.Draw(w)
+	}
+	w.SwapBuffers()
+	return true
+}
@@ -0,0 +1,320 @@
+package loop
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	gestures "github.com/ThatOtherAndrew/Hexecute/internal/gesture"
+	"github.com/ThatOtherAndrew/Hexecute/internal/learn"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
+)
+
+const frame = 1.0 / 60
+
+// newApp returns an idle app with its gestures in a temporary file, printing
+// matches instead of running them.
+func newApp(t *testing.T) *models.App {
+	t.Helper()
+	config.SetPath(filepath.Join(t.TempDir(), "gestures.json"))
+	t.Cleanup(func() { config.SetPath("") })
+	return &models.App{
+		State: models.StateIdle,
+		Settings: &config.Settings{
+			Recognizer:      config.RecognizerUnistroke,
+			StrokeTimeout:   0.5,
+			AmbiguityMargin: 0.05,
+			MaxTemplates:    10,
+		},
+		PrintMatch: true,
+	}
+}
+
+func newLoop(app *models.App) (*App, *window.Fake) {
+	loop := New(app)
+	loop.Render = false
+	return loop, &window.Fake{Width: 1920, Height: 1080}
+}
+
+// drawCircle draws a circle and releases the button.
+func drawCircle(loop *App, w *window.Fake) {
+	for i := range 60 {
+		angle := float64(i) / 59 * 2 * math.Pi
+		w.X, w.Y, w.Button = 500+100*math.Cos(angle), 400+100*math.Sin(angle), true
+		loop.Step(w, frame)
+	}
+	w.Button = false
+	loop.Step(w, frame)
+}
+
+// finish steps the loop until it ends, failing if it doesn't within the exit
+// animation.
+func finish(t *testing.T, loop *App, w *window.Fake) {
+	t.Helper()
+	for range int(exitDuration/frame) + 2 {
+		if !loop.Step(w, frame) {
+			return
+		}
+	}
+	t.Fatal("loop didn't end after the exit animation")
+}
+
+// learnCircle saves a circle gesture for command and returns the app with
+// the saved gestures loaded, ready to recognise it.
+func learnCircle(t *testing.T, command string) *models.App {
+	t.Helper()
+	app := newApp(t)
+	err := learn.New(app).Start(learn.Options{
+		Command:  command,
+		Samples:  2,
+		Rotation: models.RotationBounded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop, w := newLoop(app)
+	drawCircle(loop, w)
+	drawCircle(loop, w)
+	if app.State != models.StateExiting {
+		t.Fatalf("state after learning = %s, want %s", app.State, models.StateExiting)
+	}
+
+	saved, err := gestures.LoadGestures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range saved {
+		stroke.ForGesture(&saved[i]).Prepare(&saved[i])
+	}
+
+	return &models.App{
+		State:         models.StateIdle,
+		Settings:      app.Settings,
+		PrintMatch:    true,
+		SavedGestures: saved,
+	}
+}
+
+func TestPressAndRelease(t *testing.T) {
+	app := newApp(t)
+	loop, w := newLoop(app)
+
+	w.X, w.Y, w.Button = 100, 100, true
+	loop.Step(w, frame)
+	if app.State != models.StateDrawing {
+		t.Fatalf("state after press = %s, want %s", app.State, models.StateDrawing)
+	}
+	if len(app.Points) != 1 {
+		t.Fatalf("points after press = %d, want 1", len(app.Points))
+	}
+
+	// A stroke too short to recognise returns to idle.
+	w.Button = false
+	loop.Step(w, frame)
+	if app.State != models.StateIdle {
+		t.Fatalf("state after release = %s, want %s", app.State, models.StateIdle)
+	}
+	if app.Points != nil || app.Strokes != nil {
+		t.Fatal("stroke wasn't cleared after release")
+	}
+}
+
+func TestRecognizeAndExit(t *testing.T) {
+	app := learnCircle(t, "circle")
+	loop, w := newLoop(app)
+
+	drawCircle(loop, w)
+	if app.State != models.StateExiting {
+		t.Fatalf("state after drawing = %s, want %s", app.State, models.StateExiting)
+	}
+	if app.MatchedCommand != "circle" {
+		t.Fatalf("matched %q, want %q", app.MatchedCommand, "circle")
+	}
+	if !w.InputDisabled {
+		t.Fatal("input wasn't disabled on exit")
+	}
+	finish(t, loop, w)
+}
+
+func TestEscAborts(t *testing.T) {
+	app := learnCircle(t, "circle")
+	loop, w := newLoop(app)
+
+	for i := range 20 {
+		w.X, w.Y, w.Button = 100+float64(i)*10, 100, true
+		loop.Step(w, frame)
+	}
+	w.PressKey(window.KeyEscape)
+	loop.Step(w, frame)
+	if app.State != models.StateExiting {
+		t.Fatalf("state after Esc = %s, want %s", app.State, models.StateExiting)
+	}
+	if app.Points != nil {
+		t.Fatal("stroke wasn't discarded on Esc")
+	}
+	if w.HasKey {
+		t.Fatal("Esc wasn't cleared once handled")
+	}
+
+	// Releasing the button after aborting doesn't recognise anything.
+	w.Button = false
+	loop.Step(w, frame)
+	if app.MatchedCommand != "" {
+		t.Fatalf("matched %q after Esc", app.MatchedCommand)
+	}
+	finish(t, loop, w)
+}
+
+func TestLearnConfirmRedraw(t *testing.T) {
+	app := learnCircle(t, "circle")
+	err := learn.New(app).Start(learn.Options{
+		Command:  "other",
+		Samples:  2,
+		Rotation: models.RotationBounded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.State != models.StateLearning {
+		t.Fatalf("state after starting = %s, want %s", app.State, models.StateLearning)
+	}
+	loop, w := newLoop(app)
+
+	drawCircle(loop, w)
+	if app.State != models.StateLearning || app.Learn.Count() != 1 {
+		t.Fatalf("after one sample: state %s, count %d", app.State, app.Learn.Count())
+	}
+	drawCircle(loop, w)
+	if app.State != models.StateConfirming {
+		t.Fatalf("state after conflicting samples = %s, want %s", app.State, models.StateConfirming)
+	}
+	if app.Learn.Conflict != "circle" {
+		t.Fatalf("conflict = %q, want %q", app.Learn.Conflict, "circle")
+	}
+
+	w.PressKey(window.KeyLowerR)
+	loop.Step(w, frame)
+	if app.State != models.StateLearning || app.Learn.Count() != 0 {
+		t.Fatalf("after redraw: state %s, count %d", app.State, app.Learn.Count())
+	}
+
+	drawCircle(loop, w)
+	drawCircle(loop, w)
+	if app.State != models.StateConfirming {
+		t.Fatalf("state after redrawing = %s, want %s", app.State, models.StateConfirming)
+	}
+	w.PressKey(window.KeyReturn)
+	loop.Step(w, frame)
+	if app.State != models.StateExiting {
+		t.Fatalf("state after confirming = %s, want %s", app.State, models.StateExiting)
+	}
+	finish(t, loop, w)
+
+	saved, err := gestures.LoadGestures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gestures.Find(saved, "other") < 0 {
+		t.Fatal("confirmed gesture wasn't saved")
+	}
+}
+
+func TestOldPointsForgottenWithoutRendering(t *testing.T) {
+	app := newApp(t)
+	loop, w := newLoop(app)
+
+	// Two seconds of drawing, one new point per frame.
+	for i := range 120 {
+		w.X, w.Y, w.Button = 100+float64(i)*5, 100, true
+		loop.Step(w, frame)
+	}
+	if age := app.Now.Sub(app.Points[0].BornTime).Seconds(); age > 1.5 {
+		t.Fatalf("oldest point is %.2fs old, want at most 1.5s", age)
+	}
+}
+
+func TestLearnKeepsChangesSavedMeanwhile(t *testing.T) {
+	app := learnCircle(t, "circle")
+	err := learn.New(app).Start(learn.Options{Command: "circle", Samples: 1, Append: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process changes the gesture while it is being drawn.
+	err = gestures.Update("circle", func(gesture *models.GestureConfig) error {
+		gesture.Tags = []string{"shapes"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loop, w := newLoop(app)
+	drawCircle(loop, w)
+	if app.State != models.StateExiting {
+		t.Fatalf("state after learning = %s, want %s", app.State, models.StateExiting)
+	}
+
+	saved, err := gestures.LoadGestures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gesture := saved[gestures.Find(saved, "circle")]
+	if len(gesture.Tags) != 1 || gesture.Tags[0] != "shapes" {
+		t.Fatalf("tags = %v, want the ones saved while learning", gesture.Tags)
+	}
+	if len(gesture.Templates) != 3 {
+		t.Fatalf("templates = %d, want 3", len(gesture.Templates))
+	}
+}
+
+func TestLearnSaveFailureEndsSession(t *testing.T) {
+	app := learnCircle(t, "circle")
+	err := learn.New(app).Start(learn.Options{
+		Command:  "other",
+		Name:     "shape",
+		Samples:  1,
+		Rotation: models.RotationBounded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The name is taken while the gesture is drawn, so it can't be saved.
+	err = gestures.Update("circle", func(gesture *models.GestureConfig) error {
+		gesture.Name = "shape"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loop, w := newLoop(app)
+	drawCircle(loop, w)
+	w.PressKey(window.KeyReturn)
+	loop.Step(w, frame)
+	if app.State != models.StateExiting {
+		t.Fatalf("state after failing to save = %s, want %s", app.State, models.StateExiting)
+	}
+	if app.Learn.Err == nil {
+		t.Fatal("save error wasn't kept")
+	}
+	finish(t, loop, w)
+}
+
+func TestPrintMatchExitsWithoutMatch(t *testing.T) {
+	app := newApp(t)
+	loop, w := newLoop(app)
+
+	drawCircle(loop, w)
+	if app.State != models.StateExiting {
+		t.Fatalf("state after an unmatched gesture = %s, want %s", app.State, models.StateExiting)
+	}
+	if app.MatchedCommand != "" {
+		t.Fatalf("matched %q, want nothing", app.MatchedCommand)
+	}
+	finish(t, loop, w)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/ThatOtherAndrew/Hexecute/internal/config"
@@ -20,40 +21,157 @@ type Particle struct {
 	Hue     float32
 }
 
+// Rotation policies of a gesture. Gestures without one are matched as
+// RotationNone.
+const (
+	RotationNone    = "none"
+	RotationBounded = "bounded"
+	RotationFull    = "full"
+)
+
+const (
+	WindingClockwise        = "clockwise"
+	WindingCounterClockwise = "counterclockwise"
+)
+
+// States of the overlay. Learning is the resting state while learning a
+// gesture, in place of Idle.
+const (
+	StateIdle        = "idle"
+	StateDrawing     = "drawing"
+	StateRecognizing = "recognizing"
+	StateLearning    = "learning"
+	StateConfirming  = "confirming"
+	StateExiting     = "exiting"
+)
+
+// Direction records which way a gesture is drawn. Headings are in degrees in
+// screen space, so 0 points right and 90 points down.
+type Direction struct {
+	Winding string  `json:"winding,omitempty"`
+	Start   float64 `json:"start"`
+	Travel  float64 `json:"travel"`
+	Closed  bool    `json:"closed,omitempty"`
+}
+
+// Action is what a gesture runs: either a Shell command line, or an Exec
+// argument list that is run directly. Env adds to the inherited environment,
+// and Cwd may start with ~ for the home directory.
+type Action struct {
+	Shell string            `json:"shell,omitempty"`
+	Exec  []string          `json:"exec,omitempty"`
+	Env   map[string]string `json:"env,omitempty"`
+	Cwd   string            `json:"cwd,omitempty"`
+}
+
+// Validate checks that exactly one of Shell and Exec is set.
+func (a *Action) Validate() error {
+	switch {
+	case a.Shell != "" && len(a.Exec) > 0:
+		return errors.New("action has both shell and exec set")
+	case a.Shell == "" && len(a.Exec) == 0:
+		return errors.New("action has neither shell nor exec set")
+	case len(a.Exec) > 0 && a.Exec[0] == "":
+		return errors.New("action has an empty program to exec")
+	}
+	return nil
+}
+
+// GestureConfig is a learned gesture. Its Command identifies it, and is run
+// with sh -c unless it has an Action. A gesture with Reject set holds
+// rejection samples instead: strokes that best match it are never executed.
+// Name, when set, is shown in place of the command. A nil Enabled means the
+// gesture is enabled, so older files keep working.
 type GestureConfig struct {
-	Command   string    `json:"command"`
-	Templates [][]Point `json:"templates"`
+	Command          string      `json:"command"`
+	Name             string      `json:"name,omitempty"`
+	Description      string      `json:"description,omitempty"`
+	Tags             []string    `json:"tags,omitempty"`
+	Enabled          *bool       `json:"enabled,omitempty"`
+	Action           *Action     `json:"action,omitempty"`
+	Reject           bool        `json:"reject,omitempty"`
+	Recognizer       string      `json:"recognizer,omitempty"`
+	MinScore         float64     `json:"min_score,omitempty"`
+	Rotation         string      `json:"rotation,omitempty"`
+	StartDirection   bool        `json:"start_direction,omitempty"`
+	Direction        *Direction  `json:"direction,omitempty"`
+	EnforceDirection bool        `json:"enforce_direction,omitempty"`
+	Templates        [][]Point   `json:"templates"`
+	Strokes          [][]int     `json:"strokes,omitempty"`
+	Vectors          [][]float64 `json:"-"`
+	Prefixes         [][]Point   `json:"-"`
+}
+
+// Label is how the gesture is shown to the user: its Name, or its Command
+// when it has none.
+func (g *GestureConfig) Label() string {
+	if g.Name != "" {
+		return g.Name
+	}
+	return g.Command
+}
+
+func (g *GestureConfig) IsEnabled() bool {
+	return g.Enabled == nil || *g.Enabled
+}
+
+// LearnSession is a gesture being learned and the samples drawn for it so
+// far. The app is learning while it has one, which is set by state.Learn.
+// Gesture is what will be saved as of when learning started; Name and Action
+// are the ones given for it, if any, which replace the saved gesture's.
+type LearnSession struct {
+	Gesture  GestureConfig
+	Name     string
+	Action   *Action
+	Append   bool
+	Samples  int
+	Drawn    [][]Point
+	Strokes  [][]int
+	Hint     string
+	HintTime time.Time
+	Conflict string
+	// Err is why the gesture couldn't be saved, if it couldn't.
+	Err error
+}
+
+// Count is how many samples have been drawn.
+func (l *LearnSession) Count() int {
+	return len(l.Drawn)
 }
 
 type App struct {
-	Points            []Point
-	Particles         []Particle
-	IsDrawing         bool
-	Vao               uint32
-	Vbo               uint32
-	Program           uint32
-	ParticleVAO       uint32
-	ParticleVBO       uint32
-	ParticleProgram   uint32
-	BgVAO             uint32
-	BgVBO             uint32
-	BgProgram         uint32
-	CursorGlowVAO     uint32
-	CursorGlowVBO     uint32
-	CursorGlowProgram uint32
-	StartTime         time.Time
-	LastCursorX       float32
-	LastCursorY       float32
-	CursorVelocity    float32
-	SmoothVelocity    float32
-	SmoothRotation    float32
-	SmoothDrawing     float32
-	IsExiting         bool
-	ExitStartTime     time.Time
-	LearnMode         bool
-	LearnCommand      string
-	LearnGestures     [][]Point
-	LearnCount        int
-	SavedGestures     []GestureConfig
-	Settings          *config.Settings
+	State              string
+	StateTime          time.Time
+	StateHooks         []func(from, to string)
+	Points             []Point
+	Particles          []Particle
+	Strokes            [][]Point
+	LastStrokeTime     time.Time
+	PointsSincePreview int
+	PreviewCommand     string
+	Vao                uint32
+	Vbo                uint32
+	Program            uint32
+	ParticleVAO        uint32
+	ParticleVBO        uint32
+	ParticleProgram    uint32
+	BgVAO              uint32
+	BgVBO              uint32
+	BgProgram          uint32
+	CursorGlowVAO      uint32
+	CursorGlowVBO      uint32
+	CursorGlowProgram  uint32
+	StartTime          time.Time
+	Now                time.Time
+	LastCursorX        float32
+	LastCursorY        float32
+	CursorVelocity     float32
+	SmoothVelocity     float32
+	SmoothRotation     float32
+	SmoothDrawing      float32
+	PrintMatch         bool
+	MatchedCommand     string
+	Learn              *LearnSession
+	SavedGestures      []GestureConfig
+	Settings           *config.Settings
 }
@@ -0,0 +1,70 @@
+package preview
+
+import (
+	"github.com/ThatOtherAndrew/Hexecute/internal/execute"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+	"github.com/ThatOtherAndrew/Hexecute/internal/stroke"
+)
+
+// interval is how many new points are drawn between preview updates.
+const interval = 8
+
+type App struct {
+	app *models.App
+}
+
+func New(app *models.App) *App {
+	return &App{app: app}
+}
+
+// Update scores the stroke drawn so far against the start of every saved
+// gesture, and shows the best candidate once enough new points are drawn. A
+// candidate is only shown if releasing now could run it: it must clear its
+// threshold and the ambiguity margin, and not be the rejection samples.
+// Multistroke drawings aren't previewed, as only $P can score them.
+func (a *App) Update() {
+	if a.app.Learn != nil || a.app.PointsSincePreview < interval {
+		return
+	}
+	a.app.PointsSincePreview = 0
+
+	if len(a.app.Strokes) > 0 || len(a.app.Points) < 5 {
+		a.app.PreviewCommand = ""
+		return
+	}
+
+	bestMatch := -1
+	bestScore := 0.0
+	secondScore := 0.0
+	for i := range a.app.SavedGestures {
+		gesture := &a.app.SavedGestures[i]
+		if !gesture.IsEnabled() {
+			continue
+		}
+		score := stroke.PrefixRecognise(a.app.Points, gesture)
+		if score > bestScore {
+			secondScore = bestScore
+			bestScore = score
+			bestMatch = i
+		} else if score > secondScore {
+			secondScore = score
+		}
+	}
+
+	if bestMatch < 0 {
+		a.app.PreviewCommand = ""
+		return
+	}
+	best := &a.app.SavedGestures[bestMatch]
+	margin := float64(a.app.Settings.AmbiguityMargin)
+	if bestScore > execute.Threshold(best) && bestScore-secondScore >= margin && !best.Reject {
+		a.app.PreviewCommand = best.Label()
+	} else {
+		a.app.PreviewCommand = ""
+	}
+}
+
+func (a *App) Clear() {
+	a.app.PointsSincePreview = 0
+	a.app.PreviewCommand = ""
+}
@@ -0,0 +1,194 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
+)
+
+// replayTail is how long, in seconds, a replay keeps running after its last
+// frame, so that pending strokes are recognised and animations finish.
+const replayTail = 1.0
+
+// tailFrame is the dt of the frames played after the recording ends.
+const tailFrame = 1.0 / 60
+
+// Event is the input state the main loop saw from the window after a call to
+// PollEvents, one per frame. DT is the seconds since the previous frame.
+type Event struct {
+	DT       float32 `json:"dt"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Button   bool    `json:"button,omitempty"`
+	Key      uint32  `json:"key,omitempty"`
+	KeyState uint32  `json:"key_state,omitempty"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+}
+
+// Recorder is a Window that writes the input read from the window it wraps
+// to a file, one JSON event per frame.
+type Recorder struct {
+	window.Window
+	file     *os.File
+	encoder  *json.Encoder
+	lastPoll time.Time
+}
+
+func NewRecorder(w window.Window, path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		Window:  w,
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+func (r *Recorder) PollEvents() {
+	r.Window.PollEvents()
+	if r.encoder == nil {
+		return
+	}
+
+	// The first frame has no previous one, just as the main loop's doesn't.
+	event := Event{}
+	now := time.Now()
+	if !r.lastPoll.IsZero() {
+		event.DT = float32(now.Sub(r.lastPoll).Seconds())
+	}
+	r.lastPoll = now
+
+	event.X, event.Y = r.Window.GetCursorPos()
+	event.Button = r.Window.GetMouseButton()
+	event.Width, event.Height = r.Window.GetSize()
+	if key, state, hasKey := r.Window.GetLastKey(); hasKey {
+		event.Key, event.KeyState = key, state
+	}
+
+	if err := r.encoder.Encode(event); err != nil {
+		log.Printf("Failed to record input, stopping recording: %v", err)
+		r.encoder = nil
+	}
+}
+
+func (r *Recorder) Destroy() {
+	if err := r.file.Close(); err != nil {
+		log.Printf("Failed to save recording: %v", err)
+	}
+	r.Window.Destroy()
+}
+
+// Replayer is a Window that plays back input saved by a Recorder, one recorded
+// frame per frame of the main loop, which takes each frame's dt from
+// FrameDelta. It draws to the window it wraps, or to nothing when that window
+// is nil.
+type Replayer struct {
+	window window.Window
+	events []Event
+	next   int
+	tail   float32
+	state  Event
+	hasKey bool
+}
+
+func NewReplayer(path string, w window.Window) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Replayer{window: w, events: events}, nil
+}
+
+// FrameDelta returns the recorded dt of the next frame, or tailFrame once the
+// recording has ended.
+func (r *Replayer) FrameDelta() float32 {
+	if r.next < len(r.events) {
+		return r.events[r.next].DT
+	}
+	return tailFrame
+}
+
+func (r *Replayer) PollEvents() {
+	if r.window != nil {
+		r.window.PollEvents()
+	}
+
+	if r.next >= len(r.events) {
+		r.tail += tailFrame
+		r.hasKey = false
+		return
+	}
+	r.state = r.events[r.next]
+	r.hasKey = r.state.Key != 0
+	r.next++
+}
+
+func (r *Replayer) ShouldClose() bool {
+	return r.next >= len(r.events) && r.tail > replayTail
+}
+
+func (r *Replayer) GetSize() (int, int) {
+	if r.window != nil {
+		return r.window.GetSize()
+	}
+	return r.state.Width, r.state.Height
+}
+
+func (r *Replayer) SwapBuffers() {
+	if r.window != nil {
+		r.window.SwapBuffers()
+	}
+}
+
+func (r *Replayer) GetCursorPos() (float64, float64) {
+	return r.state.X, r.state.Y
+}
+
+func (r *Replayer) GetMouseButton() bool {
+	return r.state.Button
+}
+
+func (r *Replayer) DisableInput() {
+	if r.window != nil {
+		r.window.DisableInput()
+	}
+}
+
+func (r *Replayer) GetLastKey() (uint32, uint32, bool) {
+	if !r.hasKey {
+		return 0, 0, false
+	}
+	return r.state.Key, r.state.KeyState, true
+}
+
+func (r *Replayer) ClearLastKey() {
+	r.hasKey = false
+}
+
+func (r *Replayer) Destroy() {
+	if r.window != nil {
+		r.window.Destroy()
+	}
+}
@@ -48,3 +48,20 @@ func (a *App) SpawnExitWisps(x, y float32) {
 		})
 	}
 }
+
+func (a *App) SpawnAmbiguousSparks(x, y float32) {
+	for i := range 16 {
+		angle := float64(i) / 16 * 2 * math.Pi
+		speed := rand.Float32()*20 + 60
+		a.app.Particles = append(a.app.Particles, models.Particle{
+			X:       x,
+			Y:       y,
+			VX:      float32(math.Cos(angle)) * speed,
+			VY:      float32(math.Sin(angle)) * speed,
+			Life:    0.6,
+			MaxLife: 0.6,
+			Size:    rand.Float32()*6 + 8,
+			Hue:     0.1,
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package state
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+)
+
+// transitions lists the states each state may move to. Idle only moves to
+// Learning when learning is started, before any gesture is drawn. Learning and
+// Confirming are only entered with a learn session, see Learn.
+var transitions = map[string][]string{
+	models.StateIdle:     {models.StateDrawing, models.StateLearning, models.StateExiting},
+	models.StateLearning: {models.StateDrawing, models.StateExiting},
+	models.StateDrawing:  {models.StateRecognizing, models.StateIdle, models.StateLearning, models.StateExiting},
+	models.StateRecognizing: {
+		models.StateDrawing,
+		models.StateIdle,
+		models.StateLearning,
+		models.StateConfirming,
+		models.StateExiting,
+	},
+	models.StateConfirming: {models.StateLearning, models.StateExiting},
+	models.StateExiting:    {},
+}
+
+type App struct {
+	app *models.App
+}
+
+func New(app *models.App) *App {
+	return &App{app: app}
+}
+
+// Is reports whether the app is in any of the given states.
+func (a *App) Is(states ...string) bool {
+	return slices.Contains(states, a.app.State)
+}
+
+// Since returns how long the app has been in its current state.
+func (a *App) Since() time.Duration {
+	return a.app.Now.Sub(a.app.StateTime)
+}
+
+// To moves the app to a new state and runs its state hooks. Transitions that
+// aren't allowed from the current state are logged and ignored.
+func (a *App) To(to string) bool {
+	from := a.app.State
+	if !slices.Contains(transitions[from], to) ||
+		a.app.Learn == nil && (to == models.StateLearning || to == models.StateConfirming) {
+		log.Printf("Ignoring invalid state transition from %s to %s", from, to)
+		return false
+	}
+
+	a.app.State = to
+	a.app.StateTime = a.app.Now
+	log.Printf("State: %s -> %s", from, a.Describe())
+	for _, hook := range a.app.StateHooks {
+		hook(from, to)
+	}
+	return true
+}
+
+// Learn starts learning session, moving an idle app to Learning. The app keeps
+// the session, and returns to Learning rather than Idle, until it exits.
+func (a *App) Learn(session *models.LearnSession) bool {
+	if !a.Is(models.StateIdle) {
+		log.Printf("Ignoring invalid state transition from %s to %s", a.app.State, models.StateLearning)
+		return false
+	}
+	a.app.Learn = session
+	return a.To(models.StateLearning)
+}
+
+// Rest returns the app to waiting for a gesture: Learning while learning one,
+// or Idle otherwise.
+func (a *App) Rest() bool {
+	if a.app.Learn != nil {
+		return a.To(models.StateLearning)
+	}
+	return a.To(models.StateIdle)
+}
+
+// OnTransition registers a hook to run after every state transition.
+func (a *App) OnTransition(hook func(from, to string)) {
+	a.app.StateHooks = append(a.app.StateHooks, hook)
+}
+
+// Describe names the current state, including learning progress.
+func (a *App) Describe() string {
+	if a.app.State == models.StateLearning {
+		return fmt.Sprintf("%s (%d/%d)", a.app.State, a.app.Learn.Count(), a.app.Learn.Samples)
+	}
+	return a.app.State
+}
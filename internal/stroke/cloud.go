@@ -0,0 +1,207 @@
+// https://depts.washington.edu/acelab/proj/dollar/pdollar.pdf
+
+package stroke
+
+import (
+	"math"
+)
+
+const cloudN = 32
+
+// Step 1
+
+func resampleCloud(points []Point, starts []int, n int) ([]Point, []int) {
+	points = append([]Point(nil), points...)
+	ids := strokeIDs(len(points), starts)
+
+	I := cloudPathLength(points, ids) / float64(n-1)
+	newPoints := []Point{points[0]}
+	newIDs := []int{ids[0]}
+	if I == 0 {
+		for len(newPoints) < n {
+			newPoints = append(newPoints, points[0])
+		}
+		return newPoints, []int{0}
+	}
+
+	D := float64(0)
+	for i := 1; i < len(points); i++ {
+		if ids[i] != ids[i-1] {
+			continue
+		}
+		d := euclidean(points[i-1], points[i])
+		if D+d >= I {
+			t := float32((I - D) / d)
+			q := Point{
+				X: points[i-1].X + t*(points[i].X-points[i-1].X),
+				Y: points[i-1].Y + t*(points[i].Y-points[i-1].Y),
+			}
+			newPoints = append(newPoints, q)
+			newIDs = append(newIDs, ids[i])
+			points = append(points[:i], append([]Point{q}, points[i:]...)...)
+			ids = append(ids[:i], append([]int{ids[i]}, ids[i:]...)...)
+			D = 0
+		} else {
+			D += d
+		}
+	}
+	for len(newPoints) < n {
+		newPoints = append(newPoints, points[len(points)-1])
+		newIDs = append(newIDs, ids[len(ids)-1])
+	}
+	return newPoints[:n], strokeStarts(newIDs[:n])
+}
+
+func cloudPathLength(points []Point, ids []int) float64 {
+	d := float64(0)
+	for i := 1; i < len(points); i++ {
+		if ids[i] == ids[i-1] {
+			d += euclidean(points[i-1], points[i])
+		}
+	}
+	return d
+}
+
+func strokeIDs(length int, starts []int) []int {
+	ids := make([]int, length)
+	stroke := 0
+	for i := range ids {
+		for stroke+1 < len(starts) && i >= starts[stroke+1] {
+			stroke++
+		}
+		ids[i] = stroke
+	}
+	return ids
+}
+
+func strokeStarts(ids []int) []int {
+	var starts []int
+	for i := range ids {
+		if i == 0 || ids[i] != ids[i-1] {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+func euclidean(a, b Point) float64 {
+	return math.Sqrt(float64(distance(a, b)))
+}
+
+// Step 2
+
+func scaleCloud(points []Point) []Point {
+	minX, minY := points[0].X, points[0].Y
+	maxX, maxY := points[0].X, points[0].Y
+	for _, p := range points {
+		minX, maxX = min(minX, p.X), max(maxX, p.X)
+		minY, maxY = min(minY, p.Y), max(maxY, p.Y)
+	}
+	scale := max(maxX-minX, maxY-minY)
+	if scale == 0 {
+		scale = 1
+	}
+	for i := range points {
+		points[i].X = (points[i].X - minX) / scale
+		points[i].Y = (points[i].Y - minY) / scale
+	}
+	return points
+}
+
+// Step 3
+
+func greedyCloudMatch(points, template []Point) float64 {
+	n := len(points)
+	step := int(math.Floor(math.Pow(float64(n), 0.5)))
+	best := math.Inf(1)
+	for i := 0; i < n; i += step {
+		d1 := cloudDistance(points, template, i)
+		d2 := cloudDistance(template, points, i)
+		best = math.Min(best, math.Min(d1, d2))
+	}
+	return best
+}
+
+func cloudDistance(pts1, pts2 []Point, start int) float64 {
+	n := len(pts1)
+	matched := make([]bool, n)
+	sum := float64(0)
+	i := start
+	for {
+		index := -1
+		best := math.Inf(1)
+		for j := range matched {
+			if matched[j] {
+				continue
+			}
+			if d := euclidean(pts1[i], pts2[j]); d < best {
+				best = d
+				index = j
+			}
+		}
+		matched[index] = true
+		weight := 1 - float64((i-start+n)%n)/float64(n)
+		sum += weight * best
+		i = (i + 1) % n
+		if i == start {
+			break
+		}
+	}
+	return sum
+}
+
+func cloudRecognise(points []Point, templates [][]Point) (bestMatch int, bestScore float64) {
+	b := math.Inf(1)
+	for i, T := range templates {
+		if len(T) != len(points) {
+			T, _ = processCloud(T, nil)
+		}
+		d := greedyCloudMatch(points, T)
+		if d < b {
+			b = d
+			bestMatch = i
+		}
+	}
+	// The weights in cloudDistance sum to (n+1)/2, which turns b into a mean
+	// point distance. Greedy matching pairs each point with its nearest free
+	// neighbour, so these run far smaller than $1's path distances; a mean of
+	// a quarter of the gesture size is treated as no match at all.
+	mean := b / (float64(len(points)+1) / 2)
+	bestScore = math.Max(0, 1-mean/0.25)
+	return bestMatch, bestScore
+}
+
+func processCloud(points []Point, starts []int) ([]Point, []int) {
+	points, starts = resampleCloud(points, starts, cloudN)
+	points = scaleCloud(points)
+	points = translateTo(points, Point{X: 0, Y: 0})
+	return points, starts
+}
+
+// Entry points
+
+// ProcessCloud normalises a (possibly multistroke) gesture into a $P point
+// cloud. starts holds the index at which each stroke begins, and the returned
+// starts give the same boundaries within the resampled cloud.
+func ProcessCloud(points []Point, starts []int) ([]Point, []int) {
+	return processCloud(points, starts)
+}
+
+// CloudRecognise matches a point cloud against templates. Templates that are
+// not already point clouds, such as unistroke templates, are converted first.
+func CloudRecognise(points []Point, templates [][]Point) (bestMatch int, bestScore float64) {
+	return cloudRecognise(points, templates)
+}
+
+// JoinStrokes flattens strokes into a single point list, returning the index
+// at which each stroke begins.
+func JoinStrokes(strokes [][]Point) (points []Point, starts []int) {
+	for _, s := range strokes {
+		if len(s) == 0 {
+			continue
+		}
+		starts = append(starts, len(points))
+		points = append(points, s...)
+	}
+	return points, starts
+}
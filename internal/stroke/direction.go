@@ -0,0 +1,165 @@
+package stroke
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+)
+
+// startAngleThreshold is how far apart, in radians, the initial directions of
+// two strokes may be for them to count as starting the same way ($N uses the
+// same 30° cutoff).
+const startAngleThreshold = math.Pi / 6
+
+func startVector(points []Point) (float64, float64) {
+	i := max(1, len(points)/8)
+	i = min(i, len(points)-1)
+	dx := float64(points[i].X - points[0].X)
+	dy := float64(points[i].Y - points[0].Y)
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return 0, 0
+	}
+	return dx / length, dy / length
+}
+
+func startAngleBetween(a, b []Point) float64 {
+	ax, ay := startVector(a)
+	bx, by := startVector(b)
+	return math.Acos(math.Max(-1, math.Min(1, ax*bx+ay*by)))
+}
+
+// StartDirectionMatches reports whether two processed strokes begin by moving
+// in roughly the same direction.
+func StartDirectionMatches(a, b []Point) bool {
+	if len(a) < 2 || len(b) < 2 {
+		return true
+	}
+	return startAngleBetween(a, b) <= startAngleThreshold
+}
+
+// windingThreshold is how far, in radians, a stroke must turn overall for it
+// to count as drawn clockwise or counter-clockwise.
+const windingThreshold = math.Pi / 2
+
+// travelAngleThreshold is how far apart, in radians, the start-to-end headings
+// of two strokes may be when direction is enforced.
+const travelAngleThreshold = math.Pi / 4
+
+// closedThreshold is the start-to-end distance, as a fraction of path length,
+// below which a stroke is treated as closed and its heading is ignored.
+const closedThreshold = 0.2
+
+func totalTurning(points []Point) float64 {
+	turning := float64(0)
+	prev := math.NaN()
+	for i := 1; i < len(points); i++ {
+		dx := float64(points[i].X - points[i-1].X)
+		dy := float64(points[i].Y - points[i-1].Y)
+		if dx == 0 && dy == 0 {
+			continue
+		}
+		angle := math.Atan2(dy, dx)
+		if !math.IsNaN(prev) {
+			turning += math.Remainder(angle-prev, 2*math.Pi)
+		}
+		prev = angle
+	}
+	return turning
+}
+
+func heading(x, y float64) float64 {
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+func headingDifference(a, b float64) float64 {
+	return math.Abs(math.Remainder(a-b, 360)) * math.Pi / 180
+}
+
+// DirectionOf describes which way a processed stroke was drawn. Headings are
+// in screen space, so 0° points right and 90° points down.
+func DirectionOf(points []Point) models.Direction {
+	var d models.Direction
+	if len(points) < 2 {
+		return d
+	}
+
+	turning := totalTurning(points)
+	if turning > windingThreshold {
+		d.Winding = models.WindingClockwise
+	} else if turning < -windingThreshold {
+		d.Winding = models.WindingCounterClockwise
+	}
+
+	d.Start = heading(startVector(points))
+
+	first, last := points[0], points[len(points)-1]
+	dx, dy := float64(last.X-first.X), float64(last.Y-first.Y)
+	length := 0.0
+	for i := 1; i < len(points); i++ {
+		length += euclidean(points[i-1], points[i])
+	}
+	if length == 0 || math.Hypot(dx, dy)/length < closedThreshold {
+		d.Closed = true
+	} else {
+		d.Travel = heading(dx, dy)
+	}
+	return d
+}
+
+// CommonDirection combines the directions of several samples of a gesture,
+// keeping only the features that all of them agree on.
+func CommonDirection(templates [][]Point) models.Direction {
+	if len(templates) == 0 {
+		return models.Direction{}
+	}
+	d := DirectionOf(templates[0])
+	var startX, startY, travelX, travelY float64
+	for _, template := range templates {
+		t := DirectionOf(template)
+		if t.Winding != d.Winding {
+			d.Winding = ""
+		}
+		if t.Closed {
+			d.Closed = true
+		}
+		startX += math.Cos(t.Start * math.Pi / 180)
+		startY += math.Sin(t.Start * math.Pi / 180)
+		travelX += math.Cos(t.Travel * math.Pi / 180)
+		travelY += math.Sin(t.Travel * math.Pi / 180)
+	}
+	d.Start = heading(startX, startY)
+	if d.Closed {
+		d.Travel = 0
+	} else {
+		d.Travel = heading(travelX, travelY)
+	}
+	return d
+}
+
+// DirectionMatches reports whether a processed stroke was drawn the same way
+// as described by d: with the same winding, and heading the same way from
+// start to end unless the gesture is closed.
+func DirectionMatches(points []Point, d models.Direction) bool {
+	c := DirectionOf(points)
+	if d.Winding != "" && c.Winding != d.Winding {
+		return false
+	}
+	if !d.Closed && !c.Closed && headingDifference(c.Travel, d.Travel) > travelAngleThreshold {
+		return false
+	}
+	return true
+}
+
+// DescribeDirection formats d for display, e.g. "clockwise, heading 90°".
+func DescribeDirection(d models.Direction) string {
+	winding := d.Winding
+	if winding == "" {
+		winding = "no winding"
+	}
+	if d.Closed {
+		return winding + ", closed"
+	}
+	return fmt.Sprintf("%s, heading %.0f°", winding, d.Travel)
+}
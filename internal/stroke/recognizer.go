@@ -0,0 +1,252 @@
+package stroke
+
+import (
+	"math"
+
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
+	"github.com/ThatOtherAndrew/Hexecute/internal/models"
+)
+
+// Candidate is a drawn gesture after a Recognizer has preprocessed it.
+type Candidate struct {
+	Points []Point
+	Starts []int
+	Vector []float64
+}
+
+// Recognizer matches drawn gestures against the templates of a saved gesture.
+// A gesture's templates are only ever scored by the Recognizer that produced
+// them, which is recorded in GestureConfig.Recognizer.
+type Recognizer interface {
+	Name() string
+	// PreprocessTemplate normalises a captured sample for storage in
+	// gestures.json. starts holds the index at which each stroke begins.
+	PreprocessTemplate(points []Point, starts []int) (template []Point, templateStarts []int)
+	PreprocessCandidate(points []Point, starts []int) Candidate
+	// Prepare caches any derived template data once gestures are loaded.
+	Prepare(gesture *models.GestureConfig)
+	Score(candidate Candidate, gesture *models.GestureConfig) (bestMatch int, bestScore float64)
+}
+
+var recognizers = map[string]Recognizer{
+	config.RecognizerUnistroke:  unistroke{},
+	config.RecognizerProtractor: protractor{},
+	config.RecognizerPointCloud: pointCloud{},
+}
+
+// Get returns the Recognizer registered under name.
+func Get(name string) (Recognizer, bool) {
+	r, ok := recognizers[name]
+	return r, ok
+}
+
+// ForGesture returns the Recognizer that produced a gesture's templates.
+// Gestures saved before the recognizer was recorded fall back to the
+// algorithm that was hard-coded at the time.
+func ForGesture(gesture *models.GestureConfig) Recognizer {
+	if r, ok := recognizers[gesture.Recognizer]; ok {
+		return r
+	}
+	if gesture.Strokes != nil {
+		return pointCloud{}
+	}
+	return unistroke{}
+}
+
+// ForSettings returns the Recognizer used to learn new gestures.
+func ForSettings(settings *config.Settings) Recognizer {
+	if settings.Multistroke {
+		return pointCloud{}
+	}
+	if r, ok := recognizers[settings.Recognizer]; ok {
+		return r
+	}
+	return unistroke{}
+}
+
+// Match is how well a drawn gesture scored against one saved gesture.
+type Match struct {
+	Gesture  int
+	Template int
+	Score    float64
+}
+
+// ScoreAll scores a drawn gesture against every saved gesture, in order, using
+// each gesture's own Recognizer. Gestures drawn with more than one stroke are
+// scored with $P throughout, as only it can compare them.
+func ScoreAll(points []Point, starts []int, gestures []models.GestureConfig) []Match {
+	isMultistroke := len(starts) > 1
+	candidates := make(map[string]Candidate)
+
+	matches := make([]Match, len(gestures))
+	for i := range gestures {
+		gesture := &gestures[i]
+		recognizer := ForGesture(gesture)
+		if isMultistroke {
+			recognizer = pointCloud{}
+		}
+
+		candidate, ok := candidates[recognizer.Name()]
+		if !ok {
+			candidate = recognizer.PreprocessCandidate(points, starts)
+			candidates[recognizer.Name()] = candidate
+		}
+
+		template, score := recognizer.Score(candidate, gesture)
+		matches[i] = Match{Gesture: i, Template: template, Score: score}
+	}
+	return matches
+}
+
+type unistroke struct{}
+
+func (unistroke) Name() string { return config.RecognizerUnistroke }
+
+func (unistroke) PreprocessTemplate(points []Point, starts []int) ([]Point, []int) {
+	return ProcessStroke(points), nil
+}
+
+func (unistroke) PreprocessCandidate(points []Point, starts []int) Candidate {
+	return Candidate{Points: ProcessStroke(points)}
+}
+
+func (unistroke) Prepare(gesture *models.GestureConfig) {}
+
+func (unistroke) Score(candidate Candidate, gesture *models.GestureConfig) (int, float64) {
+	if !directionAllowed(candidate, gesture) {
+		return 0, 0
+	}
+
+	indices := startFiltered(candidate.Points, gesture.Templates, gesture.StartDirection)
+	if len(indices) == 0 {
+		return 0, 0
+	}
+
+	points, templates := candidate.Points, pick(gesture.Templates, indices)
+	maxAngle := maxRotation(gesture)
+	if gesture.Rotation == models.RotationFull {
+		// $1 only searches small angles, so remove the orientation of both
+		// sides first, as in its original rotation-invariant form.
+		points, templates = rotateAllToZero(points, templates)
+		maxAngle = math.Pi / 4
+	}
+	match, score := UnistrokeRecognise(points, templates, maxAngle)
+	return indices[match], score
+}
+
+type protractor struct{}
+
+func (protractor) Name() string { return config.RecognizerProtractor }
+
+func (protractor) PreprocessTemplate(points []Point, starts []int) ([]Point, []int) {
+	return ProcessStroke(points), nil
+}
+
+func (protractor) PreprocessCandidate(points []Point, starts []int) Candidate {
+	processed := ProcessStroke(points)
+	return Candidate{Points: processed, Vector: Vectorize(processed)}
+}
+
+func (protractor) Prepare(gesture *models.GestureConfig) {
+	gesture.Vectors = nil
+	for _, template := range gesture.Templates {
+		gesture.Vectors = append(gesture.Vectors, Vectorize(template))
+	}
+}
+
+func (p protractor) Score(candidate Candidate, gesture *models.GestureConfig) (int, float64) {
+	if !directionAllowed(candidate, gesture) {
+		return 0, 0
+	}
+
+	if len(gesture.Vectors) != len(gesture.Templates) {
+		p.Prepare(gesture)
+	}
+
+	indices := startFiltered(candidate.Points, gesture.Templates, gesture.StartDirection)
+	if len(indices) == 0 {
+		return 0, 0
+	}
+	match, score := ProtractorRecognise(candidate.Vector, pick(gesture.Vectors, indices), maxRotation(gesture))
+	return indices[match], score
+}
+
+type pointCloud struct{}
+
+func (pointCloud) Name() string { return config.RecognizerPointCloud }
+
+func (pointCloud) PreprocessTemplate(points []Point, starts []int) ([]Point, []int) {
+	return ProcessCloud(points, starts)
+}
+
+func (pointCloud) PreprocessCandidate(points []Point, starts []int) Candidate {
+	cloud, cloudStarts := ProcessCloud(points, starts)
+	return Candidate{Points: cloud, Starts: cloudStarts}
+}
+
+func (pointCloud) Prepare(gesture *models.GestureConfig) {}
+
+// Score ignores the gesture's rotation policy, as $P matches point clouds
+// without searching over rotations.
+func (pointCloud) Score(candidate Candidate, gesture *models.GestureConfig) (int, float64) {
+	if !directionAllowed(candidate, gesture) {
+		return 0, 0
+	}
+
+	indices := startFiltered(candidate.Points, gesture.Templates, gesture.StartDirection)
+	if len(indices) == 0 {
+		return 0, 0
+	}
+	match, score := CloudRecognise(candidate.Points, pick(gesture.Templates, indices))
+	return indices[match], score
+}
+
+func directionAllowed(candidate Candidate, gesture *models.GestureConfig) bool {
+	if !gesture.EnforceDirection || gesture.Direction == nil {
+		return true
+	}
+	return DirectionMatches(candidate.Points, *gesture.Direction)
+}
+
+// maxRotation is how far a drawn gesture may be rotated to match a gesture's
+// templates. Gestures saved before rotation was configurable were matched
+// without any, so they keep doing so.
+func maxRotation(gesture *models.GestureConfig) float64 {
+	switch gesture.Rotation {
+	case models.RotationBounded:
+		return math.Pi / 4
+	case models.RotationFull:
+		return math.Pi
+	default:
+		return 0
+	}
+}
+
+func rotateAllToZero(points []Point, templates [][]Point) ([]Point, [][]Point) {
+	rotated := make([][]Point, len(templates))
+	for i, template := range templates {
+		rotated[i] = RotateToZero(template)
+	}
+	return RotateToZero(points), rotated
+}
+
+// startFiltered returns the indices of the templates that points may be
+// compared against: all of them, unless check requires the start direction
+// to agree.
+func startFiltered(points []Point, templates [][]Point, check bool) []int {
+	indices := make([]int, 0, len(templates))
+	for i, template := range templates {
+		if !check || StartDirectionMatches(points, template) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+func pick[T any](items []T, indices []int) []T {
+	picked := make([]T, len(indices))
+	for i, index := range indices {
+		picked[i] = items[index]
+	}
+	return picked
+}
@@ -1,10 +1,12 @@
 // https://depts.washington.edu/acelab/proj/dollar/dollar.pdf
+// https://dl.acm.org/doi/10.1145/1753326.1753654 (Protractor)
 
 package stroke
 
 import (
 	"math"
 
+	"github.com/ThatOtherAndrew/Hexecute/internal/config"
 	"github.com/ThatOtherAndrew/Hexecute/internal/models"
 )
 
@@ -13,6 +15,7 @@ import (
 type Point = models.Point
 
 func resample(points []Point, n int) []Point {
+	points = append([]Point(nil), points...)
 	I := pathLength(points) / float32(n-1)
 	D := float32(0)
 	newPoints := []Point{points[0]}
@@ -51,25 +54,43 @@ func distance(a Point, b Point) float32 {
 
 // Step 2
 
+func indicativeAngle(points []Point) float64 {
+	c := centroid(points)
+	return math.Atan2(float64(c.Y-points[0].Y), float64(c.X-points[0].X))
+}
+
 func rotateBy(points []Point, angle float64) []Point {
 	c := centroid(points)
-	for _, p := range points {
+	newPoints := make([]Point, len(points))
+	for i, p := range points {
 		qx := float64(p.X-c.X)*math.Cos(angle) - float64(p.Y-c.Y)*math.Sin(angle) + float64(c.X)
 		qy := float64(p.X-c.X)*math.Sin(angle) + float64(p.Y-c.Y)*math.Cos(angle) + float64(c.Y)
-		p.X = float32(qx)
-		p.Y = float32(qy)
+		newPoints[i] = Point{X: float32(qx), Y: float32(qy)}
 	}
-	return points
+	return newPoints
 }
 
 // Step 3
 
+// oneDThreshold is the bounding box ratio below which a stroke is treated as
+// one-dimensional (e.g. a straight swipe) and scaled uniformly, as stretching
+// its thin side to size would blow up noise or divide by zero.
+const oneDThreshold = 0.3
+
 func scaleTo(points []Point, size float32) []Point {
 	B := boundingBox(points)
+	longest := max(B.width, B.height)
+	if longest == 0 {
+		return points
+	}
+	scaleX, scaleY := size/B.width, size/B.height
+	if min(B.width, B.height)/longest < oneDThreshold {
+		scaleX, scaleY = size/longest, size/longest
+	}
 	for i := range points {
 		p := &points[i]
-		p.X = p.X * (size / B.width)
-		p.Y = p.Y * (size / B.height)
+		p.X = p.X * scaleX
+		p.Y = p.Y * scaleY
 	}
 	return points
 }
@@ -120,10 +141,16 @@ func recognise(
 	points []Point,
 	templates [][]Point,
 	size float64,
+	maxAngle float64,
 ) (bestMatch int, bestScore float64) {
 	b := math.Inf(1)
 	for i, T := range templates {
-		d := distanceAtBestAngle(points, T, -math.Pi/4, math.Pi/4, math.Pi/90)
+		var d float64
+		if maxAngle == 0 {
+			d = pathDistance(points, T)
+		} else {
+			d = distanceAtBestAngle(points, T, -maxAngle, maxAngle, math.Pi/90)
+		}
 		if d < b {
 			b = d
 			bestMatch = i
@@ -133,23 +160,25 @@ func recognise(
 	return bestMatch, bestScore
 }
 
+var phi = 0.5 * (-1 + math.Sqrt(5))
+
 func distanceAtBestAngle(points, T []Point, a, b, delta float64) float64 {
-	x1 := math.Phi*a + (1-math.Phi)*b
+	x1 := phi*a + (1-phi)*b
 	f1 := distanceAtAngle(points, T, x1)
-	x2 := (1-math.Phi)*a + math.Phi*b
+	x2 := (1-phi)*a + phi*b
 	f2 := distanceAtAngle(points, T, x2)
 	for math.Abs(b-a) > delta {
 		if f1 < f2 {
 			b = x2
 			x2 = x1
 			f2 = f1
-			x1 = math.Phi*a + (1-math.Phi)*b
+			x1 = phi*a + (1-phi)*b
 			f1 = distanceAtAngle(points, T, x1)
 		} else {
 			a = x1
 			x1 = x2
 			f1 = f2
-			x2 = (1-math.Phi)*a + math.Phi*b
+			x2 = (1-phi)*a + phi*b
 			f2 = distanceAtAngle(points, T, x2)
 		}
 	}
@@ -170,6 +199,80 @@ func pathDistance(A, B []Point) float64 {
 	return d / float64(len(A))
 }
 
+// Protractor
+
+func vectorize(points []Point) []float64 {
+	vector := make([]float64, 0, len(points)*2)
+	sum := float64(0)
+	for _, p := range points {
+		vector = append(vector, float64(p.X), float64(p.Y))
+		sum += float64(p.X*p.X + p.Y*p.Y)
+	}
+	magnitude := math.Sqrt(sum)
+	if magnitude == 0 {
+		return vector
+	}
+	for i := range vector {
+		vector[i] /= magnitude
+	}
+	return vector
+}
+
+// optimalCosineSimilarity finds the rotation of v1 that best aligns it with
+// v2 in closed form, clamped to ±maxAngle.
+func optimalCosineSimilarity(v1, v2 []float64, maxAngle float64) float64 {
+	a, b := float64(0), float64(0)
+	for i := 0; i+1 < len(v1) && i+1 < len(v2); i += 2 {
+		a += v1[i]*v2[i] + v1[i+1]*v2[i+1]
+		b += v1[i]*v2[i+1] - v1[i+1]*v2[i]
+	}
+	angle := math.Atan2(b, a)
+	angle = math.Max(-maxAngle, math.Min(maxAngle, angle))
+	return a*math.Cos(angle) + b*math.Sin(angle)
+}
+
+func protractorRecognise(
+	vector []float64,
+	templates [][]float64,
+	maxAngle float64,
+) (bestMatch int, bestScore float64) {
+	best := math.Inf(-1)
+	for i, T := range templates {
+		s := optimalCosineSimilarity(vector, T, maxAngle)
+		if s > best {
+			best = s
+			bestMatch = i
+		}
+	}
+	// Map the angle between the vectors onto 0-1 so that scores stay
+	// comparable with $1: identical shapes score 1, orthogonal ones 0.
+	best = math.Max(-1, math.Min(1, best))
+	bestScore = math.Max(0, 1-math.Acos(best)/(math.Pi/2))
+	return bestMatch, bestScore
+}
+
+// Early recognition
+
+// prefixFractions are the portions of each template that a stroke still being
+// drawn is compared against, since it is not yet known how far along it is.
+var prefixFractions = []float64{0.25, 0.375, 0.5, 0.625, 0.75, 0.875, 1}
+
+func prefixTemplates(templates [][]Point) [][]Point {
+	var prefixes [][]Point
+	for _, T := range templates {
+		for _, f := range prefixFractions {
+			k := max(2, int(f*float64(len(T))))
+			if k > len(T) || pathLength(T[:k]) == 0 {
+				continue
+			}
+			if prefix := ProcessStroke(T[:k]); IsFinite(prefix) {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	return prefixes
+}
+
 // Entry points
 
 const n = 64
@@ -185,6 +288,82 @@ func ProcessStroke(points []Point) []Point {
 	return points
 }
 
-func UnistrokeRecognise(points []Point, templates [][]Point) (bestMatch int, bestScore float64) {
-	return recognise(points, templates, size)
+// IsFinite reports whether every coordinate in points is a finite number.
+func IsFinite(points []Point) bool {
+	for _, p := range points {
+		if math.IsNaN(float64(p.X)) || math.IsInf(float64(p.X), 0) ||
+			math.IsNaN(float64(p.Y)) || math.IsInf(float64(p.Y), 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// UnistrokeRecognise matches points against templates with $1, searching
+// rotations within ±maxAngle.
+func UnistrokeRecognise(
+	points []Point,
+	templates [][]Point,
+	maxAngle float64,
+) (bestMatch int, bestScore float64) {
+	return recognise(points, templates, size, maxAngle)
+}
+
+func Vectorize(points []Point) []float64 {
+	return vectorize(points)
+}
+
+// ProtractorRecognise matches a vectorised stroke against vectorised
+// templates, allowing rotations within ±maxAngle.
+func ProtractorRecognise(
+	vector []float64,
+	templates [][]float64,
+	maxAngle float64,
+) (bestMatch int, bestScore float64) {
+	return protractorRecognise(vector, templates, maxAngle)
+}
+
+// RotateToZero rotates points about their centroid so that the angle from
+// the centroid to the first point is zero, removing their orientation.
+func RotateToZero(points []Point) []Point {
+	return rotateBy(points, -indicativeAngle(points))
+}
+
+// PrefixTemplates returns processed prefixes of each template, for matching
+// strokes that are still being drawn with PrefixRecognise.
+func PrefixTemplates(templates [][]Point) [][]Point {
+	return prefixTemplates(templates)
+}
+
+// PrefixRecognise scores a stroke that is still being drawn against the
+// starts of a gesture's templates, under the same rotation and direction rules
+// as the gesture's Recognizer. It returns 0 if the stroke cannot be compared
+// yet, or the gesture is multistroke, as $P has no notion of a prefix.
+func PrefixRecognise(points []Point, gesture *models.GestureConfig) float64 {
+	if gesture.Strokes != nil || ForGesture(gesture).Name() == config.RecognizerPointCloud {
+		return 0
+	}
+	if len(points) < 2 || pathLength(points) == 0 {
+		return 0
+	}
+	processed := ProcessStroke(points)
+	if !IsFinite(processed) || !directionAllowed(Candidate{Points: processed}, gesture) {
+		return 0
+	}
+
+	if gesture.Prefixes == nil {
+		gesture.Prefixes = prefixTemplates(gesture.Templates)
+	}
+	prefixes := pick(gesture.Prefixes, startFiltered(processed, gesture.Prefixes, gesture.StartDirection))
+	if len(prefixes) == 0 {
+		return 0
+	}
+
+	maxAngle := maxRotation(gesture)
+	if gesture.Rotation == models.RotationFull {
+		processed, prefixes = rotateAllToZero(processed, prefixes)
+		maxAngle = math.Pi / 4
+	}
+	_, score := recognise(processed, prefixes, size, maxAngle)
+	return score
 }
@@ -4,7 +4,7 @@ import (
 	"math"
 
 	"github.com/ThatOtherAndrew/Hexecute/internal/models"
-	"github.com/ThatOtherAndrew/Hexecute/pkg/wayland"
+	"github.com/ThatOtherAndrew/Hexecute/internal/window"
 )
 
 type App struct {
@@ -31,7 +31,7 @@ func (a *App) UpdateParticles(dt float32) {
 	}
 }
 
-func (a *App) UpdateCursor(window *wayland.WaylandWindow) {
+func (a *App) UpdateCursor(window window.Window) {
 	x, y := window.GetCursorPos()
 	fx, fy := float32(x), float32(y)
 
@@ -58,7 +58,7 @@ func (a *App) UpdateCursor(window *wayland.WaylandWindow) {
 	}
 
 	var targetDrawing float32
-	if a.app.IsDrawing {
+	if a.app.State == models.StateDrawing {
 		targetDrawing = 1.0
 	} else {
 		targetDrawing = 0.0
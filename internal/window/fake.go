@@ -0,0 +1,43 @@
+package window
+
+// Fake is an in-memory Window whose input is set through its fields, so the
+// main loop can be driven without a compositor.
+type Fake struct {
+	Width, Height int
+	X, Y          float64
+	Button        bool
+	Key, KeyState uint32
+	HasKey        bool
+	Closed        bool
+	InputDisabled bool
+	Frames        int
+}
+
+func (f *Fake) GetSize() (int, int) { return f.Width, f.Height }
+
+func (f *Fake) ShouldClose() bool { return f.Closed }
+
+func (f *Fake) SwapBuffers() { f.Frames++ }
+
+func (f *Fake) PollEvents() {}
+
+func (f *Fake) GetCursorPos() (float64, float64) { return f.X, f.Y }
+
+func (f *Fake) GetMouseButton() bool { return f.Button && !f.InputDisabled }
+
+func (f *Fake) DisableInput() { f.InputDisabled = true }
+
+func (f *Fake) GetLastKey() (uint32, uint32, bool) { return f.Key, f.KeyState, f.HasKey }
+
+// ClearLastKey forgets the last key, like WaylandWindow does once the main
+// loop has handled it.
+func (f *Fake) ClearLastKey() {
+	f.Key, f.KeyState, f.HasKey = 0, 0, false
+}
+
+// PressKey reports a key press on the next frame.
+func (f *Fake) PressKey(key uint32) {
+	f.Key, f.KeyState, f.HasKey = key, 1, true
+}
+
+func (f *Fake) Destroy() { f.Closed = true }
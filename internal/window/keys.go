@@ -0,0 +1,10 @@
+package window
+
+// XKB keysyms reported by GetLastKey.
+const (
+	KeyEscape   = 0xff1b
+	KeyReturn   = 0xff0d
+	KeyKPEnter  = 0xff8d
+	KeyLowerR   = 0x0072
+	KeyCapitalR = 0x0052
+)
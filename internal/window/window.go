@@ -0,0 +1,17 @@
+package window
+
+// Window is the overlay the main loop draws to and reads input from. It is
+// implemented by wayland.WaylandWindow, by record.Replayer to feed a recorded
+// session back through the same code, and by Fake for driving it in memory.
+type Window interface {
+	GetSize() (int, int)
+	ShouldClose() bool
+	SwapBuffers()
+	PollEvents()
+	GetCursorPos() (float64, float64)
+	GetMouseButton() bool
+	DisableInput()
+	GetLastKey() (uint32, uint32, bool)
+	ClearLastKey()
+	Destroy()
+}
@@ -2,6 +2,8 @@
 #include "keyboard-shortcuts-inhibit-client.h"
 #include "tablet-v2.h"
 #include "wlr-layer-shell-client.h"
+#include <errno.h>
+#include <poll.h>
 #include <stdbool.h>
 #include <stdint.h>
 #include <string.h>
@@ -270,6 +272,30 @@ void set_input_region(int32_t width, int32_t height) {
   }
 }
 
+// Reads whatever events the compositor has sent and dispatches them, without
+// waiting if there are none.
+int dispatch_nonblocking(struct wl_display *display) {
+  while (wl_display_prepare_read(display) != 0) {
+    if (wl_display_dispatch_pending(display) < 0) {
+      return -1;
+    }
+  }
+  if (wl_display_flush(display) < 0 && errno != EAGAIN) {
+    wl_display_cancel_read(display);
+    return -1;
+  }
+
+  struct pollfd fd = {.fd = wl_display_get_fd(display), .events = POLLIN};
+  if (poll(&fd, 1, 0) > 0) {
+    if (wl_display_read_events(display) < 0) {
+      return -1;
+    }
+  } else {
+    wl_display_cancel_read(display);
+  }
+  return wl_display_dispatch_pending(display);
+}
+
 void disable_all_input() {
   if (shortcuts_inhibitor) {
     zwp_keyboard_shortcuts_inhibitor_v1_destroy(shortcuts_inhibitor);
@@ -623,3 +649,30 @@ void clear_last_key() {
 EGLNativeWindowType native_window(struct wl_egl_window *egl_window) {
   return (EGLNativeWindowType)egl_window;
 }
+
+void inhibit_shortcuts() {
+  if (shortcuts_inhibit_manager && surface_global && seat && keyboard &&
+      !shortcuts_inhibitor) {
+    shortcuts_inhibitor =
+        zwp_keyboard_shortcuts_inhibit_manager_v1_inhibit_shortcuts(
+            shortcuts_inhibit_manager, surface_global, seat);
+  }
+}
+
+void destroy_layer_surface() {
+  if (shortcuts_inhibitor) {
+    zwp_keyboard_shortcuts_inhibitor_v1_destroy(shortcuts_inhibitor);
+    shortcuts_inhibitor = NULL;
+  }
+
+  if (layer_surface_global) {
+    zwlr_layer_surface_v1_destroy(layer_surface_global);
+    layer_surface_global = NULL;
+  }
+  surface_global = NULL;
+
+  button_state = 0;
+  touch_id = -1;
+  last_key = 0;
+  last_key_state = 0;
+}
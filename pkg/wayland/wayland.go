@@ -28,6 +28,7 @@ type WaylandWindow struct {
 	eglWindow     *C.struct_wl_egl_window
 	eglDisplay    C.EGLDisplay
 	eglContext    C.EGLContext
+	eglConfig     C.EGLConfig
 	eglSurface    C.EGLSurface
 	width, height int32
 }
@@ -55,9 +56,66 @@ func NewWaylandWindow() (*WaylandWindow, error) {
 		return nil, &WaylandError{"layer shell not available"}
 	}
 
+	if err := w.createSurface(); err != nil {
+		return nil, err
+	}
+
+	if err := w.initEGL(); err != nil {
+		return nil, err
+	}
+
+	if err := w.createEGLSurface(); err != nil {
+		return nil, err
+	}
+
+	w.commit()
+
+	return w, nil
+}
+
+// Hide unmaps the overlay, keeping the Wayland connection and EGL context
+// (and so any GL objects) alive until Show maps it again.
+func (w *WaylandWindow) Hide() {
+	C.eglMakeCurrent(w.eglDisplay, C.EGLSurface(C.EGL_NO_SURFACE), C.EGLSurface(C.EGL_NO_SURFACE), w.eglContext)
+	if w.eglSurface != C.EGLSurface(C.EGL_NO_SURFACE) {
+		C.eglDestroySurface(w.eglDisplay, w.eglSurface)
+		w.eglSurface = C.EGLSurface(C.EGL_NO_SURFACE)
+	}
+	if w.eglWindow != nil {
+		C.wl_egl_window_destroy(w.eglWindow)
+		w.eglWindow = nil
+	}
+
+	C.destroy_layer_surface()
+	w.layerSurface = nil
+	if w.surface != nil {
+		C.wl_surface_destroy(w.surface)
+		w.surface = nil
+	}
+
+	C.wl_display_roundtrip(w.display)
+}
+
+// Show maps the overlay again after Hide.
+func (w *WaylandWindow) Show() error {
+	if err := w.createSurface(); err != nil {
+		return err
+	}
+
+	if err := w.createEGLSurface(); err != nil {
+		return err
+	}
+
+	C.inhibit_shortcuts()
+	w.commit()
+
+	return nil
+}
+
+func (w *WaylandWindow) createSurface() error {
 	w.surface = C.wl_compositor_create_surface(C.compositor)
 	if w.surface == nil {
-		return nil, &WaylandError{"failed to create surface"}
+		return &WaylandError{"failed to create surface"}
 	}
 
 	w.layerSurface = C.create_layer_surface(w.surface)
@@ -78,26 +136,19 @@ func NewWaylandWindow() (*WaylandWindow, error) {
 
 	C.set_input_region(C.int32_t(w.width), C.int32_t(w.height))
 
-	if err := w.initEGL(); err != nil {
-		return nil, err
-	}
+	return nil
+}
 
+func (w *WaylandWindow) commit() {
 	C.wl_surface_commit(w.surface)
 	C.wl_display_flush(w.display)
 
 	C.wl_display_roundtrip(w.display)
 	C.wl_display_roundtrip(w.display)
 	C.wl_display_flush(w.display)
-
-	return w, nil
 }
 
 func (w *WaylandWindow) initEGL() error {
-	w.eglWindow = C.wl_egl_window_create(w.surface, C.int(w.width), C.int(w.height))
-	if w.eglWindow == nil {
-		return fmt.Errorf("failed to create EGL window")
-	}
-
 	w.eglDisplay = C.get_egl_display(w.display)
 	if w.eglDisplay == C.EGLDisplay(C.EGL_NO_DISPLAY) {
 		errCode := C.get_egl_error()
@@ -119,9 +170,8 @@ func (w *WaylandWindow) initEGL() error {
 		C.EGL_NONE,
 	}
 
-	var config C.EGLConfig
 	var numConfigs C.EGLint
-	if C.eglChooseConfig(w.eglDisplay, &configAttribs[0], &config, 1, &numConfigs) == C.EGL_FALSE {
+	if C.eglChooseConfig(w.eglDisplay, &configAttribs[0], &w.eglConfig, 1, &numConfigs) == C.EGL_FALSE {
 		return fmt.Errorf("failed to choose EGL config")
 	}
 
@@ -133,14 +183,23 @@ func (w *WaylandWindow) initEGL() error {
 		C.EGL_NONE,
 	}
 
-	w.eglContext = C.eglCreateContext(w.eglDisplay, config, nil, &contextAttribs[0])
+	w.eglContext = C.eglCreateContext(w.eglDisplay, w.eglConfig, nil, &contextAttribs[0])
 	if w.eglContext == nil {
 		return fmt.Errorf("failed to create EGL context")
 	}
 
+	return nil
+}
+
+func (w *WaylandWindow) createEGLSurface() error {
+	w.eglWindow = C.wl_egl_window_create(w.surface, C.int(w.width), C.int(w.height))
+	if w.eglWindow == nil {
+		return fmt.Errorf("failed to create EGL window")
+	}
+
 	w.eglSurface = C.eglCreateWindowSurface(
 		w.eglDisplay,
-		config,
+		w.eglConfig,
 		C.native_window(w.eglWindow),
 		nil,
 	)
@@ -178,6 +237,17 @@ func (w *WaylandWindow) PollEvents() {
 	C.wl_display_dispatch_pending(w.display)
 }
 
+// Dispatch reads and handles the events the compositor has sent, without
+// waiting for more. PollEvents only handles events that have already been
+// read, which eglSwapBuffers does while the overlay is drawn, so Dispatch is
+// what keeps up with the compositor while it is hidden.
+func (w *WaylandWindow) Dispatch() error {
+	if C.dispatch_nonblocking(w.display) < 0 {
+		return &WaylandError{"failed to dispatch Wayland events"}
+	}
+	return nil
+}
+
 func (w *WaylandWindow) GetCursorPos() (float64, float64) {
 	var x, y C.double
 	C.get_mouse_pos(&x, &y)
@@ -34,6 +34,7 @@ void add_registry_listener(struct wl_registry *registry);
 struct zwlr_layer_surface_v1 *create_layer_surface(struct wl_surface *surface);
 void set_input_region(int32_t width, int32_t height);
 void disable_all_input();
+int dispatch_nonblocking(struct wl_display *display);
 void pointer_enter(void *data, struct wl_pointer *pointer, uint32_t serial,
                    struct wl_surface *surface, wl_fixed_t x, wl_fixed_t y);
 void pointer_leave(void *data, struct wl_pointer *pointer, uint32_t serial,
@@ -154,6 +155,8 @@ uint32_t get_last_key();
 uint32_t get_last_key_state();
 void clear_last_key();
 EGLNativeWindowType native_window(struct wl_egl_window *egl_window);
+void inhibit_shortcuts();
+void destroy_layer_surface();
 
 extern struct wl_compositor *compositor;
 extern struct zwlr_layer_shell_v1 *layer_shell;